@@ -0,0 +1,75 @@
+// Command configcrypt generates keys and encrypts values for enc: config fields.
+//
+//	configcrypt keygen > config.key
+//	configcrypt encrypt -key-file config.key 's3cr3t'
+//	echo -n 's3cr3t' | CONFIG_KEY=... configcrypt encrypt -key-env CONFIG_KEY
+package main
+
+import (
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/tiburon-777/modules/core/config"
+)
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: configcrypt keygen | encrypt [-key-file file | -key-env var] [value]")
+	}
+	switch args[0] {
+	case "keygen":
+		key, err := config.NewKey()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(os.Stdout, base64.StdEncoding.EncodeToString(key))
+		return nil
+	case "encrypt":
+		return encrypt(args[1:])
+	default:
+		return fmt.Errorf("unknown command %s", args[0])
+	}
+}
+
+// encrypt prints enc: value of the argument or of the stdin if there is no argument.
+func encrypt(args []string) error {
+	fs := flag.NewFlagSet("encrypt", flag.ContinueOnError)
+	keyFile := fs.String("key-file", "", "file with base64 key")
+	keyEnv := fs.String("key-env", "", "env variable with base64 key")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	key, err := config.LoadKey(config.Config{EncryptionKeyFile: *keyFile, EncryptionKeyEnv: *keyEnv})
+	if err != nil {
+		return err
+	}
+	if key == nil {
+		return fmt.Errorf("key is not set, use -key-file or -key-env")
+	}
+	var value string
+	if fs.NArg() > 0 {
+		value = fs.Arg(0)
+	} else {
+		data, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("can't read value: %w", err)
+		}
+		value = string(data)
+	}
+	res, err := config.Encrypt(key, value)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stdout, res)
+	return nil
+}
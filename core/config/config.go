@@ -1,66 +1,219 @@
 package config
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"reflect"
 	"strings"
+	"time"
 
-	"github.com/BurntSushi/toml"
-
-	// mysql driver.
-	_ "github.com/go-sql-driver/mysql"
-
-	// psql driver.
-	_ "github.com/lib/pq"
+	"github.com/tiburon-777/modules/core/logger"
 )
 
 type Interface struct {
-	str interface{}
+	str     interface{}
+	hooks   map[reflect.Type]DecodeHook
+	formats map[string]FileDecoder
+	prov    *provenance
+	watch   *watchState
+	holder  *Holder
+	keys    *keyring
+	events  func(Event)
 }
 
+// DecodeHook converts the raw string value into the value of registered type.
+type DecodeHook func(value string) (interface{}, error)
+
 type Config struct {
-	ConfigFile string
-	EnvPrefix  string
-	DSN        string
+	ConfigFile    string
+	ConfigFormat  string
+	DotEnvFile    string
+	EnvPrefix     string
+	DSN           string
+	DB            *sql.DB // used instead of DSN if set, it is not closed by Combine
+	DBTable       DBTable
+	Args          []string
+	Sources       []Source
+	WatchInterval time.Duration
+	// Query returning a single value which changes with the config table, e.g. SELECT max(updated_at) FROM config.
+	// If set, WatchDB re-reads the table only when this value changes. SaveToDB bumps updated_at on postgres
+	// only if DBTable.UpdatedAtColumn is set.
+	DBVersionQuery string
+	// Limits of dialing DSN with ping and of reading the config table, no limits if zero.
+	DBConnectTimeout time.Duration
+	DBQueryTimeout   time.Duration
+	// Number of retries of the DB source in Combine. The first retry is made after DBRetryDelay,
+	// the delay doubles for every next one up to DBMaxRetryDelay.
+	DBRetries       int
+	DBRetryDelay    time.Duration
+	DBMaxRetryDelay time.Duration
+	// Base64 key of enc: values is read from the file or from the env variable with the given name.
+	EncryptionKeyFile string
+	EncryptionKeyEnv  string
+	// Combine reports applied sources to Logger at info level and set fields at debug level,
+	// the same events are passed to OnEvent. Combine is silent if both are nil.
+	Logger  logger.Interface
+	OnEvent func(Event)
 }
 
-// Simple constructor.
+// Simple constructor, str must be a non-nil pointer to the config struct.
+// Otherwise Holder returns nil and methods filling the struct return the error.
 func New(str interface{}) Interface {
-	return Interface{str: str}
+	h, _ := NewHolder(str)
+	return Interface{str: str, hooks: make(map[reflect.Type]DecodeHook), formats: defaultFormats(), prov: newProvenance(), watch: &watchState{}, holder: h, keys: &keyring{}}
+}
+
+// Method returns holder of config snapshots updated after successful Combine and Reload.
+// Use it to read config concurrently with Watch and WatchDB. Holder is nil if New got not a pointer.
+func (s Interface) Holder() *Holder {
+	return s.holder
+}
+
+// Method registers decoder for the config file format, name is used as file extension too.
+func (s Interface) RegisterFormat(name string, dec FileDecoder) {
+	s.formats[strings.ToLower(name)] = dec
+}
+
+// Method registers decode hook for all fields of the given type.
+// Hooks take precedence over UnmarshalText methods and built-in conversions.
+func (s Interface) RegisterHook(t reflect.Type, hook DecodeHook) {
+	s.hooks[t] = hook
+}
+
+func (s Interface) decoder() decoder {
+	return decoder{hooks: s.hooks, prov: s.prov, aead: s.keys.get(), events: s.events}
 }
 
 // Method wraps discrete methods.
+// Sources are applied in the order of c.Sources or DefaultSources, the last one wins.
 func (s Interface) Combine(c Config) error {
-	if c.ConfigFile != "" {
-		fmt.Printf("try to apply config from file %s...\n", c.ConfigFile)
-		if err := s.SetFromFile(c.ConfigFile); err != nil {
-			return fmt.Errorf("can't apply config from file: %w", err)
+	return s.CombineContext(context.Background(), c)
+}
+
+// Method is Combine which stops applying sources when ctx is done.
+// The deadline of ctx limits DB dialing, queries and retries.
+func (s Interface) CombineContext(ctx context.Context, c Config) error {
+	s.events = emitter(c)
+	s.watch.keepBase(reflect.ValueOf(s.str))
+	s.prov.reset()
+	key, err := LoadKey(c)
+	if err != nil {
+		return fmt.Errorf("can't load encryption key: %w", err)
+	}
+	if key != nil {
+		if err = s.SetKey(key); err != nil {
+			return err
 		}
 	}
-	if c.EnvPrefix != "" {
-		fmt.Printf("try to apply config from environment...\n")
+	if err := s.SetDefaults(); err != nil {
+		return fmt.Errorf("can't apply default values: %w", err)
+	}
+	sources := c.Sources
+	if len(sources) == 0 {
+		sources = DefaultSources
+	}
+	for _, src := range sources {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("can't apply config: %w", err)
+		}
+		if err := s.apply(ctx, c, src); err != nil {
+			return err
+		}
+	}
+	if err := s.Validate(); err != nil {
+		return err
+	}
+	if s.holder != nil {
+		return s.holder.Store(s.str)
+	}
+	return nil
+}
+
+func (s Interface) apply(ctx context.Context, c Config, src Source) error {
+	var name string
+	switch src {
+	case SourceDefault:
+		return nil
+	case SourceFile:
+		if c.ConfigFile == "" {
+			return nil
+		}
+		format := c.ConfigFormat
+		if format == "" {
+			format = formatOf(c.ConfigFile, s.formats)
+		}
+		if err := s.SetFromFileFormat(c.ConfigFile, format); err != nil {
+			return fmt.Errorf("can't apply config from file: %w", err)
+		}
+		name = c.ConfigFile
+	case SourceDotEnv:
+		if c.DotEnvFile == "" {
+			return nil
+		}
+		if err := s.SetFromDotEnv(c.DotEnvFile, c.EnvPrefix); err != nil {
+			return fmt.Errorf("can't apply dotenv file to config: %w", err)
+		}
+		name = c.DotEnvFile
+	case SourceEnv:
+		if c.EnvPrefix == "" {
+			return nil
+		}
 		if err := s.SetFromEnv(c.EnvPrefix); err != nil {
 			return fmt.Errorf("can't apply envvars to config:%w", err)
 		}
-	}
-	if c.DSN != "" {
-		fmt.Printf("try to apply config from DSN %s...\n", c.DSN)
-		db, dbname, err := DialDSN(c.DSN)
+		name = c.EnvPrefix
+	case SourceDB:
+		if c.DB == nil && c.DSN == "" {
+			return nil
+		}
+		kv, err := readRetry(ctx, c)
 		if err != nil {
-			return fmt.Errorf("can't dial DB:%w", err)
+			return fmt.Errorf("can't apply db lines to config:%w", err)
 		}
-		if err := s.SetFromDB(db, dbname); err != nil {
+		if err = s.setFromDB(kv); err != nil {
 			return fmt.Errorf("can't apply db lines to config:%w", err)
 		}
+		if c.DB == nil {
+			name = redactDSN(c.DSN)
+		}
+	case SourceFlags:
+		if c.Args == nil {
+			return nil
+		}
+		if err := s.SetFromFlags(c.Args); err != nil {
+			return fmt.Errorf("can't apply flags to config: %w", err)
+		}
+	default:
+		return fmt.Errorf("unknown config source %s", src)
 	}
+	s.emit(Event{Kind: EventSource, Origin: Origin{Source: src, Name: name}})
 	return nil
 }
 
+// Method sets config fields to values of their default tags.
+func (s Interface) SetDefaults() error {
+	v := reflect.ValueOf(s.str)
+	if v.Kind() != reflect.Ptr {
+		return fmt.Errorf("not a pointer value")
+	}
+	return s.decoder().setDefaults(reflect.Indirect(v), "")
+}
+
 // Method adds and replace config fields from file.
+// Format is detected by the file extension, TOML is used for unknown ones.
 func (s Interface) SetFromFile(fileName string) error {
+	return s.SetFromFileFormat(fileName, formatOf(fileName, s.formats))
+}
+
+// Method adds and replace config fields from file of the given format.
+func (s Interface) SetFromFileFormat(fileName, format string) error {
+	dec, ok := s.formats[strings.ToLower(format)]
+	if !ok {
+		return fmt.Errorf("unknown config file format %s", format)
+	}
 	f, err := os.Open(fileName)
 	if err != nil {
 		return fmt.Errorf("can't open config file: %w", err)
@@ -70,67 +223,21 @@ func (s Interface) SetFromFile(fileName string) error {
 	if err != nil {
 		return fmt.Errorf("can't read content of the config file : %w", err)
 	}
-	_, err = toml.Decode(string(l), s.str)
+	m, err := dec(l)
 	if err != nil {
 		return fmt.Errorf("can't parce config file : %w", err)
 	}
+	kv := make(map[string]interface{})
+	flatten("", m, kv)
+	src := mapSource(formatStyle(format), kv)
+	src.origin = fileOrigin(SourceFile, fileName, l, fileStyle.sep)
+	if err = parseToStruct(s.decoder(), reflect.ValueOf(s.str), src); err != nil {
+		return fmt.Errorf("can't parse into struct: %w", err)
+	}
 	return nil
 }
 
 // Method adds and replace config fields from env.
 func (s Interface) SetFromEnv(prefix string) error {
-	return getEnvVar(reflect.ValueOf(s.str), reflect.TypeOf(s.str), -1, prefix)
-}
-
-func DialDSN(dsn string) (db *sql.DB, dbname string, err error) {
-	m := strings.FieldsFunc(dsn, func(r rune) bool { return r == ':' || r == '@' || r == '/' })
-	dbName := m[len(m)-1]
-	if dbName == "" {
-		return nil, "", fmt.Errorf("DSN not contains database name: %s", dsn)
-	}
-
-	var driver string
-	switch {
-	case strings.HasPrefix(dsn, "postgres://"):
-		driver = "postgres"
-		dsn = strings.TrimLeft(dsn, "postgres://")
-	case strings.HasPrefix(dsn, "mysql://"):
-		driver = "mysql"
-		dsn = strings.TrimLeft(dsn, "mysql://")
-	default:
-		return nil, "", fmt.Errorf("can't use unknown SQL dialect")
-	}
-
-	db, err = sql.Open(driver, dsn)
-	if err != nil {
-		return nil, "", fmt.Errorf("can't connect to DB: %w", err)
-	}
-	return db, dbName, nil
-}
-
-// Method adds and replace config fields from db.
-func (s Interface) SetFromDB(db *sql.DB, dbname string) error {
-	defer db.Close()
-	res := make(map[string]string)
-	var key, val string
-
-	//TODO: Перенести это в параметры.
-	table := "config"
-	q := "SELECT " + table + ".key, " + table + ".value FROM " + table
-	results, err := db.Query(q)
-	if err != nil || results.Err() != nil {
-		return fmt.Errorf("can't get key-value pairs from DB: %w", err)
-	}
-	defer results.Close()
-	for results.Next() {
-		err = results.Scan(&key, &val)
-		if err != nil {
-			return fmt.Errorf("can't parse key-value into vars: %w", err)
-		}
-		res[strings.ToLower(key)] = val
-	}
-	if err = parseToStruct(reflect.ValueOf(s.str), reflect.TypeOf(s.str), -1, "", res); err != nil {
-		return fmt.Errorf("can't parse into struct: %w", err)
-	}
-	return nil
+	return getEnvVar(s.decoder(), reflect.ValueOf(s.str), prefix)
 }
@@ -2,12 +2,17 @@ package config
 
 import (
 	"database/sql"
+	"fmt"
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/stretchr/testify/require"
 	"io/ioutil"
 	"log"
+	"net"
+	"net/url"
 	"os"
+	"reflect"
 	"testing"
+	"time"
 )
 
 type TestConf struct {
@@ -101,6 +106,44 @@ func TestSetFromFilePositive(t *testing.T) {
 		require.NoError(t, err)
 		require.Equal(t, TestConf{}, c)
 	})
+
+	// Массивы, таблицы и числа любой разрядности из файла приводятся к типам полей.
+	t.Run("Arrays and sized numbers", func(t *testing.T) {
+		file, err := ioutil.TempFile("", "conf.")
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer os.Remove(file.Name())
+		file.WriteString(`hosts = ["a", "b"]
+ports = [80, 443]
+port = 8080
+weight = 0.5
+
+[[backends]]
+host = "c"
+port = 81`)
+		file.Sync()
+
+		var c ArraysConf
+		require.NoError(t, New(&c).SetFromFile(file.Name()))
+		require.Equal(t, ArraysConf{
+			Hosts: []string{"a", "b"}, Ports: []uint16{80, 443}, Port: 8080, Weight: 0.5,
+			Backends: []Backend{{Host: "c", Port: 81}},
+		}, c)
+	})
+}
+
+type Backend struct {
+	Host string
+	Port int
+}
+
+type ArraysConf struct {
+	Hosts    []string
+	Ports    []uint16
+	Port     uint
+	Weight   float32
+	Backends []Backend
 }
 
 func TestSetFromFileNegative(t *testing.T) {
@@ -318,6 +361,489 @@ func TestSetFromDBNegative(t *testing.T) {
 	})
 }
 
+type TagsConf struct {
+	Section1 struct {
+		DBHost  string `config:"db_host" env:"DB_HOST"`
+		DBPort  int    `db:"port"`
+		Skipped string `config:"-"`
+	} `env:"LEGACY"`
+}
+
+func TestTags(t *testing.T) {
+
+	// Если заданы теги, имена переменных окружения берутся из них, а поля с "-" пропускаются.
+	t.Run("Tags in env", func(t *testing.T) {
+		for k, v := range map[string]string{"APP_LEGACY_DB_HOST": "localhost", "APP_LEGACY_DBPORT": "5432", "APP_LEGACY_SKIPPED": "value"} {
+			require.NoError(t, os.Setenv(k, v))
+			defer os.Unsetenv(k)
+		}
+		var c TagsConf
+		i := New(&c)
+		err := i.SetFromEnv("APP")
+		require.NoError(t, err)
+		require.Equal(t, "localhost", c.Section1.DBHost)
+		require.Equal(t, 5432, c.Section1.DBPort)
+		require.Equal(t, "", c.Section1.Skipped)
+	})
+
+	// Если заданы теги, ключи в базе берутся из них.
+	t.Run("Tags in DB", func(t *testing.T) {
+		db, mock := newMock()
+		defer db.Close()
+
+		rows := sqlmock.NewRows([]string{"key", "value"})
+		rows.AddRow("section1.db_host", "localhost")
+		rows.AddRow("section1.port", "5432")
+		rows.AddRow("section1.skipped", "value")
+
+		mock.ExpectQuery("SELECT config.key, config.value FROM config").WillReturnRows(rows)
+		var c TagsConf
+		i := New(&c)
+		err := i.SetFromDB(db, "config")
+		require.NoError(t, err)
+		require.Equal(t, "localhost", c.Section1.DBHost)
+		require.Equal(t, 5432, c.Section1.DBPort)
+		require.Equal(t, "", c.Section1.Skipped)
+	})
+
+	// Если заданы теги, ключи в файле берутся из тега config.
+	t.Run("Tags in file", func(t *testing.T) {
+		file, err := ioutil.TempFile("", "conf.")
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer os.Remove(file.Name())
+		file.WriteString(
+			`[section1]
+				db_host = "localhost"
+				dbport = 5432
+				skipped = "value"`)
+		file.Sync()
+
+		var c TagsConf
+		i := New(&c)
+		err = i.SetFromFile(file.Name())
+		require.NoError(t, err)
+		require.Equal(t, "localhost", c.Section1.DBHost)
+		require.Equal(t, 5432, c.Section1.DBPort)
+		require.Equal(t, "", c.Section1.Skipped)
+	})
+
+	// Поля встроенной структуры в файле читаются как поля родителя, как в toml и json.
+	t.Run("Embedded structs in file", func(t *testing.T) {
+		file, err := ioutil.TempFile("", "conf.")
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer os.Remove(file.Name())
+		file.WriteString("host = \"h\"\nport = 8080")
+		file.Sync()
+
+		var c EmbConf
+		require.NoError(t, New(&c).SetFromFile(file.Name()))
+		require.Equal(t, EmbConf{Base: Base{Host: "h"}, Port: 8080}, c)
+	})
+
+	// Указатель не на структуру заполняется из переменной с именем префикса.
+	t.Run("Not a struct", func(t *testing.T) {
+		require.NoError(t, os.Setenv("PX", "5"))
+		defer os.Unsetenv("PX")
+		var x int
+		require.NoError(t, New(&x).SetFromEnv("PX"))
+		require.Equal(t, 5, x)
+	})
+}
+
+type Base struct {
+	Host string
+}
+
+type EmbConf struct {
+	Base
+	Port int
+}
+
+type DefaultsConf struct {
+	Section1 struct {
+		VarInt1    int    `default:"11"`
+		VarString1 string `default:"first string"`
+		VarBool1   bool   `default:"true"`
+	}
+}
+
+func TestDefaults(t *testing.T) {
+
+	// Если заданы теги default, метод заполнит ими конфиг.
+	t.Run("Defaults applying", func(t *testing.T) {
+		var c DefaultsConf
+		i := New(&c)
+		err := i.SetDefaults()
+		require.NoError(t, err)
+		require.Equal(t, 11, c.Section1.VarInt1)
+		require.Equal(t, "first string", c.Section1.VarString1)
+		require.Equal(t, true, c.Section1.VarBool1)
+	})
+
+	// Значения по умолчанию применяются до всех источников и переписываются ими.
+	t.Run("Defaults overridden in Combine", func(t *testing.T) {
+		require.NoError(t, os.Setenv("DEF_SECTION1_VARINT1", "22"))
+		defer os.Unsetenv("DEF_SECTION1_VARINT1")
+		var c DefaultsConf
+		i := New(&c)
+		err := i.Combine(Config{EnvPrefix: "DEF"})
+		require.NoError(t, err)
+		require.Equal(t, 22, c.Section1.VarInt1)
+		require.Equal(t, "first string", c.Section1.VarString1)
+	})
+
+	// Если значение по умолчанию не соответствует типу, метод вернет ошибку.
+	t.Run("Bad default value", func(t *testing.T) {
+		var c struct {
+			VarInt int `default:"first string"`
+		}
+		i := New(&c)
+		err := i.SetDefaults()
+		require.Error(t, err)
+	})
+}
+
+type TypesConf struct {
+	Int8    int8
+	Int64   int64
+	Uint16  uint16
+	Uint64  uint64
+	Float32 float32
+	Float64 float64
+	Timeout time.Duration
+	Started time.Time
+}
+
+func TestSelectorTypes(t *testing.T) {
+
+	// Если все значения корректны, метод заполнит поля всех скалярных типов.
+	t.Run("All scalar types", func(t *testing.T) {
+		db, mock := newMock()
+		defer db.Close()
+
+		rows := sqlmock.NewRows([]string{"key", "value"})
+		rows.AddRow("int8", "-128")
+		rows.AddRow("int64", "9223372036854775807")
+		rows.AddRow("uint16", "65535")
+		rows.AddRow("uint64", "18446744073709551615")
+		rows.AddRow("float32", "1.5")
+		rows.AddRow("float64", "2.25")
+		rows.AddRow("timeout", "5s")
+		rows.AddRow("started", "2020-12-01T10:00:00Z")
+
+		mock.ExpectQuery("SELECT config.key, config.value FROM config").WillReturnRows(rows)
+		var c TypesConf
+		i := New(&c)
+		err := i.SetFromDB(db, "config")
+		require.NoError(t, err)
+		require.Equal(t, TypesConf{
+			Int8:    -128,
+			Int64:   9223372036854775807,
+			Uint16:  65535,
+			Uint64:  18446744073709551615,
+			Float32: 1.5,
+			Float64: 2.25,
+			Timeout: 5 * time.Second,
+			Started: time.Date(2020, 12, 1, 10, 0, 0, 0, time.UTC),
+		}, c)
+	})
+
+	// Если значение не помещается в тип, метод вернет ошибку.
+	t.Run("Overflow", func(t *testing.T) {
+		for k, v := range map[string]string{"TYPES_INT8": "128", "TYPES_UINT16": "65536", "TYPES_UINT64": "-1"} {
+			require.NoError(t, os.Setenv(k, v))
+			var c TypesConf
+			err := New(&c).SetFromEnv("TYPES")
+			require.Error(t, err, k)
+			require.NoError(t, os.Unsetenv(k))
+		}
+	})
+
+	// Если тип поля не поддерживается, метод вернет ошибку, а не проигнорирует значение.
+	t.Run("Unsupported type", func(t *testing.T) {
+		require.NoError(t, os.Setenv("TYPES_CH", "value"))
+		defer os.Unsetenv("TYPES_CH")
+		var c struct {
+			Ch chan int
+		}
+		err := New(&c).SetFromEnv("TYPES")
+		require.Error(t, err)
+	})
+}
+
+type CollectionsConf struct {
+	Hosts  []string
+	Ports  []int `sep:";"`
+	Labels map[string]string
+	Nodes  []struct {
+		Name string
+		Port int
+	}
+}
+
+func TestCollections(t *testing.T) {
+
+	// Списки и словари читаются из одной переменной окружения через разделитель.
+	t.Run("Separated values in env", func(t *testing.T) {
+		for k, v := range map[string]string{"COLL_HOSTS": "a, b,c", "COLL_PORTS": "80;443", "COLL_LABELS": "env=prod,team=core"} {
+			require.NoError(t, os.Setenv(k, v))
+			defer os.Unsetenv(k)
+		}
+		var c CollectionsConf
+		err := New(&c).SetFromEnv("COLL")
+		require.NoError(t, err)
+		require.Equal(t, []string{"a", "b", "c"}, c.Hosts)
+		require.Equal(t, []int{80, 443}, c.Ports)
+		require.Equal(t, map[string]string{"env": "prod", "team": "core"}, c.Labels)
+	})
+
+	// Списки читаются из индексированных переменных окружения, в том числе списки структур.
+	t.Run("Indexed values in env", func(t *testing.T) {
+		for k, v := range map[string]string{"COLL_HOSTS_0": "a", "COLL_HOSTS_1": "b", "COLL_NODES_0_NAME": "first", "COLL_NODES_1_PORT": "8080"} {
+			require.NoError(t, os.Setenv(k, v))
+			defer os.Unsetenv(k)
+		}
+		var c CollectionsConf
+		err := New(&c).SetFromEnv("COLL")
+		require.NoError(t, err)
+		require.Equal(t, []string{"a", "b"}, c.Hosts)
+		require.Len(t, c.Nodes, 2)
+		require.Equal(t, "first", c.Nodes[0].Name)
+		require.Equal(t, 8080, c.Nodes[1].Port)
+	})
+
+	// Списки и словари читаются из базы как из одного ключа, так и из вложенных.
+	t.Run("Collections in DB", func(t *testing.T) {
+		db, mock := newMock()
+		defer db.Close()
+
+		rows := sqlmock.NewRows([]string{"key", "value"})
+		rows.AddRow("hosts", "a,b")
+		rows.AddRow("ports.0", "80")
+		rows.AddRow("ports.1", "443")
+		rows.AddRow("labels.env", "prod")
+
+		mock.ExpectQuery("SELECT config.key, config.value FROM config").WillReturnRows(rows)
+		var c CollectionsConf
+		err := New(&c).SetFromDB(db, "config")
+		require.NoError(t, err)
+		require.Equal(t, []string{"a", "b"}, c.Hosts)
+		require.Equal(t, []int{80, 443}, c.Ports)
+		require.Equal(t, map[string]string{"env": "prod"}, c.Labels)
+	})
+
+	// Списки и словари из файла заполняются так же.
+	t.Run("Collections in file", func(t *testing.T) {
+		file, err := ioutil.TempFile("", "conf.")
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer os.Remove(file.Name())
+		file.WriteString(
+			`hosts = ["a", "b"]
+				ports = [80, 443]
+				[labels]
+					env = "prod"
+				[[nodes]]
+					name = "first"
+					port = 8080`)
+		file.Sync()
+
+		var c CollectionsConf
+		err = New(&c).SetFromFile(file.Name())
+		require.NoError(t, err)
+		require.Equal(t, []string{"a", "b"}, c.Hosts)
+		require.Equal(t, []int{80, 443}, c.Ports)
+		require.Equal(t, map[string]string{"env": "prod"}, c.Labels)
+		require.Len(t, c.Nodes, 1)
+		require.Equal(t, "first", c.Nodes[0].Name)
+		require.Equal(t, 8080, c.Nodes[0].Port)
+	})
+
+	// Индексы должны идти подряд с 0, пропуск или огромный индекс - ошибка, а не аллокация.
+	t.Run("Index gaps", func(t *testing.T) {
+		for _, k := range []string{"COLLGAP_HOSTS_1", "COLLGAP_HOSTS_99999999999999"} {
+			require.NoError(t, os.Setenv(k, "x"))
+			var c CollectionsConf
+			err := New(&c).SetFromEnv("COLLGAP")
+			require.Error(t, err)
+			require.NoError(t, os.Unsetenv(k))
+		}
+
+		db, mock := newMock()
+		defer db.Close()
+		rows := sqlmock.NewRows([]string{"key", "value"})
+		rows.AddRow("hosts.0", "a")
+		rows.AddRow("hosts.99999999999999", "b")
+		mock.ExpectQuery("SELECT config.key, config.value FROM config").WillReturnRows(rows)
+		var c CollectionsConf
+		require.Error(t, New(&c).SetFromDB(db, "config"))
+	})
+
+	// Если элемент словаря не в формате k=v, метод вернет ошибку.
+	t.Run("Bad map entry", func(t *testing.T) {
+		require.NoError(t, os.Setenv("COLL_LABELS", "env"))
+		defer os.Unsetenv("COLL_LABELS")
+		var c CollectionsConf
+		err := New(&c).SetFromEnv("COLL")
+		require.Error(t, err)
+	})
+}
+
+type TLSConf struct {
+	Cert string
+	Port int `default:"443"`
+}
+
+type PointersConf struct {
+	TLS     *TLSConf
+	Timeout *int
+	Retries *int `default:"3"`
+}
+
+type Node struct {
+	Name string
+	Next *Node
+}
+
+type NodesConf struct {
+	Head *Node
+}
+
+func TestPointers(t *testing.T) {
+
+	// Если в источнике нет ключей для указателя, он остается nil.
+	t.Run("Not configured pointers", func(t *testing.T) {
+		var c PointersConf
+		err := New(&c).SetFromEnv("PTR")
+		require.NoError(t, err)
+		require.Nil(t, c.TLS)
+		require.Nil(t, c.Timeout)
+	})
+
+	// Если ключ есть хотя бы для одного вложенного поля, указатель создается со значениями по умолчанию.
+	t.Run("Allocated pointers", func(t *testing.T) {
+		for k, v := range map[string]string{"PTR_TLS_CERT": "cert.pem", "PTR_TIMEOUT": "0"} {
+			require.NoError(t, os.Setenv(k, v))
+			defer os.Unsetenv(k)
+		}
+		var c PointersConf
+		err := New(&c).SetFromEnv("PTR")
+		require.NoError(t, err)
+		require.Equal(t, &TLSConf{Cert: "cert.pem", Port: 443}, c.TLS)
+		require.NotNil(t, c.Timeout)
+		require.Equal(t, 0, *c.Timeout)
+	})
+
+	// Указатели из базы заполняются так же, тег default создает указатель.
+	t.Run("Pointers in DB", func(t *testing.T) {
+		db, mock := newMock()
+		defer db.Close()
+
+		rows := sqlmock.NewRows([]string{"key", "value"})
+		rows.AddRow("tls.port", "8443")
+
+		mock.ExpectQuery("SELECT config.key, config.value FROM config").WillReturnRows(rows)
+		var c PointersConf
+		i := New(&c)
+		require.NoError(t, i.SetDefaults())
+		err := i.SetFromDB(db, "config")
+		require.NoError(t, err)
+		require.Equal(t, &TLSConf{Port: 8443}, c.TLS)
+		require.Nil(t, c.Timeout)
+		require.Equal(t, 3, *c.Retries)
+	})
+
+	// Самоссылающиеся типы заполняются на глубину, для которой в источнике есть ключи.
+	t.Run("Self-referential pointers", func(t *testing.T) {
+		for k, v := range map[string]string{"NODE_HEAD_NAME": "first", "NODE_HEAD_NEXT_NAME": "second"} {
+			require.NoError(t, os.Setenv(k, v))
+			defer os.Unsetenv(k)
+		}
+		var c NodesConf
+		err := New(&c).SetFromEnv("NODE")
+		require.NoError(t, err)
+		require.Equal(t, &Node{Name: "first", Next: &Node{Name: "second"}}, c.Head)
+	})
+}
+
+type Level int
+
+func (l *Level) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "debug":
+		*l = 0
+	case "info":
+		*l = 1
+	default:
+		return fmt.Errorf("unknown level %s", text)
+	}
+	return nil
+}
+
+type CustomConf struct {
+	IP    net.IP
+	Level Level
+	URL   url.URL
+}
+
+func TestCustomDecoders(t *testing.T) {
+
+	// Типы с методом UnmarshalText и зарегистрированными хуками читаются из окружения.
+	t.Run("TextUnmarshaler and hooks in env", func(t *testing.T) {
+		for k, v := range map[string]string{"CUST_IP": "10.0.0.1", "CUST_LEVEL": "info", "CUST_URL": "http://example.com/path"} {
+			require.NoError(t, os.Setenv(k, v))
+			defer os.Unsetenv(k)
+		}
+		var c CustomConf
+		i := New(&c)
+		i.RegisterHook(reflect.TypeOf(url.URL{}), func(value string) (interface{}, error) {
+			u, err := url.Parse(value)
+			if err != nil {
+				return nil, err
+			}
+			return *u, nil
+		})
+		err := i.SetFromEnv("CUST")
+		require.NoError(t, err)
+		require.Equal(t, net.ParseIP("10.0.0.1"), c.IP)
+		require.Equal(t, Level(1), c.Level)
+		require.Equal(t, "example.com", c.URL.Host)
+	})
+
+	// Хук имеет приоритет над методом UnmarshalText, значения из базы декодируются так же.
+	t.Run("Hook overrides TextUnmarshaler in DB", func(t *testing.T) {
+		db, mock := newMock()
+		defer db.Close()
+
+		rows := sqlmock.NewRows([]string{"key", "value"})
+		rows.AddRow("level", "verbose")
+
+		mock.ExpectQuery("SELECT config.key, config.value FROM config").WillReturnRows(rows)
+		var c CustomConf
+		i := New(&c)
+		i.RegisterHook(reflect.TypeOf(Level(0)), func(value string) (interface{}, error) {
+			return Level(len(value)), nil
+		})
+		err := i.SetFromDB(db, "config")
+		require.NoError(t, err)
+		require.Equal(t, Level(7), c.Level)
+	})
+
+	// Если UnmarshalText вернул ошибку, метод вернет ошибку.
+	t.Run("Unmarshal error", func(t *testing.T) {
+		require.NoError(t, os.Setenv("CUST_LEVEL", "trace"))
+		defer os.Unsetenv("CUST_LEVEL")
+		var c CustomConf
+		err := New(&c).SetFromEnv("CUST")
+		require.Error(t, err)
+	})
+}
+
 func TestCombinePositive(t *testing.T) {
 	// Успешное чтение из файла, окружения и базы
 	// Считанные из базы переписывают считанные из окружения, которые переписывают считанные из файла
@@ -0,0 +1,141 @@
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+)
+
+// encPrefix marks the value encrypted by Encrypt.
+const encPrefix = "enc:"
+
+// keyring holds the cipher of enc: values shared by copies of Interface.
+type keyring struct {
+	mu   sync.RWMutex
+	aead cipher.AEAD
+}
+
+func (k *keyring) get() cipher.AEAD {
+	if k == nil {
+		return nil
+	}
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.aead
+}
+
+// Method sets the key of enc: values, it must be 16, 24 or 32 bytes long.
+// Combine sets the key itself if Config.EncryptionKeyFile or Config.EncryptionKeyEnv is given.
+func (s Interface) SetKey(key []byte) error {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+	if s.keys == nil {
+		return fmt.Errorf("config is not created by New")
+	}
+	s.keys.mu.Lock()
+	s.keys.aead = aead
+	s.keys.mu.Unlock()
+	return nil
+}
+
+// Function returns new random key of 32 bytes for AES-256-GCM.
+func NewKey() ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, fmt.Errorf("can't generate key: %w", err)
+	}
+	return key, nil
+}
+
+// Function decodes base64 key as it is stored in key files and env variables.
+func ParseKey(s string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("can't decode base64 key: %w", err)
+	}
+	return key, nil
+}
+
+// Function encrypts the value with AES-GCM, the result is enc: followed by base64 of the nonce and the sealed value.
+func Encrypt(key []byte, value string) (string, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+	return encrypt(aead, value)
+}
+
+func encrypt(aead cipher.AEAD, value string) (string, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", fmt.Errorf("can't generate nonce: %w", err)
+	}
+	return encPrefix + base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, []byte(value), nil)), nil
+}
+
+// Function decrypts the value made by Encrypt.
+func Decrypt(key []byte, value string) (string, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+	return decrypt(aead, value)
+}
+
+func decrypt(aead cipher.AEAD, value string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encPrefix))
+	if err != nil {
+		return "", fmt.Errorf("can't decode encrypted value: %w", err)
+	}
+	if len(data) < aead.NonceSize() {
+		return "", fmt.Errorf("encrypted value is too short")
+	}
+	res, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("can't decrypt value: %w", err)
+	}
+	return string(res), nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("bad encryption key: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("bad encryption key: %w", err)
+	}
+	return aead, nil
+}
+
+// Function reads the key from c.EncryptionKeyFile or c.EncryptionKeyEnv, nil is returned if none of them is set.
+func LoadKey(c Config) ([]byte, error) {
+	var raw string
+	switch {
+	case c.EncryptionKeyFile != "":
+		data, err := ioutil.ReadFile(c.EncryptionKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("can't read key file: %w", err)
+		}
+		raw = string(data)
+	case c.EncryptionKeyEnv != "":
+		val, ok := os.LookupEnv(c.EncryptionKeyEnv)
+		if !ok {
+			return nil, fmt.Errorf("env variable %s with the key is not set", c.EncryptionKeyEnv)
+		}
+		raw = val
+	default:
+		return nil, nil
+	}
+	return ParseKey(raw)
+}
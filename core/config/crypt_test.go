@@ -0,0 +1,73 @@
+package config
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncrypt(t *testing.T) {
+	key, err := NewKey()
+	require.NoError(t, err)
+
+	// Зашифрованное значение расшифровывается только тем же ключом.
+	t.Run("Round trip", func(t *testing.T) {
+		enc, err := Encrypt(key, "s3cr3t")
+		require.NoError(t, err)
+		require.True(t, strings.HasPrefix(enc, "enc:"))
+		require.NotContains(t, enc, "s3cr3t")
+		res, err := Decrypt(key, enc)
+		require.NoError(t, err)
+		require.Equal(t, "s3cr3t", res)
+
+		other, err := NewKey()
+		require.NoError(t, err)
+		_, err = Decrypt(other, enc)
+		require.Error(t, err)
+		_, err = Decrypt(key, enc[:len(enc)-4]+"AAAA")
+		require.Error(t, err)
+		_, err = Encrypt([]byte("short"), "s3cr3t")
+		require.Error(t, err)
+	})
+
+	// Значения enc: расшифровываются ключом из переменной окружения или файла до присвоения полю.
+	t.Run("Combine with key", func(t *testing.T) {
+		enc, err := Encrypt(key, "s3cr3t")
+		require.NoError(t, err)
+		require.NoError(t, os.Setenv("ENC_KEY", base64.StdEncoding.EncodeToString(key)))
+		defer os.Unsetenv("ENC_KEY")
+		require.NoError(t, os.Setenv("ENC_SECTION1_VARSTRING1", enc))
+		defer os.Unsetenv("ENC_SECTION1_VARSTRING1")
+
+		var c TestConf
+		require.NoError(t, New(&c).Combine(Config{EnvPrefix: "ENC", EncryptionKeyEnv: "ENC_KEY"}))
+		require.Equal(t, "s3cr3t", c.Section1.VarString1)
+
+		file, err := ioutil.TempFile("", "key.")
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer os.Remove(file.Name())
+		file.WriteString(base64.StdEncoding.EncodeToString(key) + "\n")
+		file.Close()
+		c = TestConf{}
+		require.NoError(t, New(&c).Combine(Config{EnvPrefix: "ENC", EncryptionKeyFile: file.Name()}))
+		require.Equal(t, "s3cr3t", c.Section1.VarString1)
+	})
+
+	// Без ключа зашифрованное значение не может быть применено.
+	t.Run("No key", func(t *testing.T) {
+		enc, err := Encrypt(key, "s3cr3t")
+		require.NoError(t, err)
+		require.NoError(t, os.Setenv("ENCN_SECTION1_VARSTRING1", enc))
+		defer os.Unsetenv("ENCN_SECTION1_VARSTRING1")
+		var c TestConf
+		require.Error(t, New(&c).Combine(Config{EnvPrefix: "ENCN"}))
+		require.Error(t, New(&c).Combine(Config{EnvPrefix: "ENCN", EncryptionKeyEnv: "ENCN_MISSING_KEY"}))
+	})
+}
@@ -0,0 +1,236 @@
+package config
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	// mysql driver.
+	_ "github.com/go-sql-driver/mysql"
+
+	// psql driver.
+	_ "github.com/lib/pq"
+)
+
+var plainIdent = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// DBTable describes the table SetFromDBTable reads config key-value pairs from.
+type DBTable struct {
+	Dialect     string // registered dialect like postgres or mysql, identifiers are not quoted if empty
+	Schema      string
+	Name        string // config by default
+	KeyColumn   string // key by default
+	ValueColumn string // value by default
+	// Column set to CURRENT_TIMESTAMP by SaveToDB, e.g. updated_at of CreateTable. Postgres has no
+	// ON UPDATE CURRENT_TIMESTAMP, so without it SaveToDB edits don't change max(updated_at) there.
+	UpdatedAtColumn string
+	// Optional filter with ? placeholders, e.g. app = ? AND env = ?, so several services can share one table.
+	// Placeholders need Dialect, Combine takes it from the DSN scheme but not from Config.DB.
+	Where string
+	Args  []interface{}
+}
+
+// DefaultRetryDelay and DefaultMaxRetryDelay are used by Combine if Config.DBRetryDelay and Config.DBMaxRetryDelay are not set.
+const (
+	DefaultRetryDelay    = time.Second
+	DefaultMaxRetryDelay = 30 * time.Second
+)
+
+// Function opens DB of the DSN URL and checks the connection, see ParseDSN for the DSN format.
+func DialDSN(dsn string) (db *sql.DB, dbname string, err error) {
+	return DialDSNContext(context.Background(), dsn)
+}
+
+// Function opens DB of the DSN URL and pings it, ctx limits the ping.
+func DialDSNContext(ctx context.Context, dsn string) (db *sql.DB, dbname string, err error) {
+	d, err := ParseDSN(dsn)
+	if err != nil {
+		return nil, "", err
+	}
+	driverDSN, err := d.DriverDSN()
+	if err != nil {
+		return nil, "", err
+	}
+	dialect, _ := lookupDialect(d.Driver)
+	db, err = sql.Open(dialect.Driver, driverDSN)
+	if err != nil {
+		return nil, "", fmt.Errorf("can't connect to DB: %w", err)
+	}
+	if err = db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, "", fmt.Errorf("can't ping DB: %w", err)
+	}
+	return db, d.DBName, nil
+}
+
+// Method adds and replace config fields from the default config table of db.
+// The db is not closed, so one connection pool can be reused by the caller.
+func (s Interface) SetFromDB(db *sql.DB, dbname string) error {
+	return s.SetFromDBTableContext(context.Background(), db, DBTable{})
+}
+
+// Method is SetFromDB which cancels the query when ctx is done.
+func (s Interface) SetFromDBContext(ctx context.Context, db *sql.DB, dbname string) error {
+	return s.SetFromDBTableContext(ctx, db, DBTable{})
+}
+
+// Method adds and replace config fields from the config table of db described by t.
+func (s Interface) SetFromDBTable(db *sql.DB, t DBTable) error {
+	return s.SetFromDBTableContext(context.Background(), db, t)
+}
+
+// Method is SetFromDBTable which cancels the query when ctx is done.
+func (s Interface) SetFromDBTableContext(ctx context.Context, db *sql.DB, t DBTable) error {
+	res, err := readDB(ctx, db, t)
+	if err != nil {
+		return err
+	}
+	return s.setFromDB(res)
+}
+
+func (s Interface) setFromDB(kv map[string]interface{}) error {
+	src := mapSource(dbStyle, kv)
+	src.origin = func(key string) Origin { return Origin{Source: SourceDB, Name: key} }
+	if err := parseToStruct(s.decoder(), reflect.ValueOf(s.str), src); err != nil {
+		return fmt.Errorf("can't parse into struct: %w", err)
+	}
+	return nil
+}
+
+// readRetry reads the config table of c and retries failures with exponential backoff.
+func readRetry(ctx context.Context, c Config) (map[string]interface{}, error) {
+	delay, maxDelay := c.DBRetryDelay, c.DBMaxRetryDelay
+	if delay <= 0 {
+		delay = DefaultRetryDelay
+	}
+	if maxDelay <= 0 {
+		maxDelay = DefaultMaxRetryDelay
+	}
+	for i := 0; ; i++ {
+		kv, err := readConfigDB(ctx, c)
+		if err == nil || i >= c.DBRetries {
+			return kv, err
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, fmt.Errorf("%w, last error: %v", ctx.Err(), err)
+		case <-timer.C:
+		}
+		if delay *= 2; delay > maxDelay {
+			delay = maxDelay
+		}
+	}
+}
+
+// readConfigDB reads the config table of c.DB or of the pool dialed from c.DSN once.
+func readConfigDB(ctx context.Context, c Config) (map[string]interface{}, error) {
+	db, t := c.DB, c.DBTable
+	if db == nil {
+		dctx, cancel := withTimeout(ctx, c.DBConnectTimeout)
+		defer cancel()
+		var err error
+		if db, _, err = DialDSNContext(dctx, c.DSN); err != nil {
+			return nil, fmt.Errorf("can't dial DB:%w", err)
+		}
+		defer db.Close()
+		if t.Dialect == "" {
+			t.Dialect = dialectOf(c.DSN)
+		}
+	}
+	qctx, cancel := withTimeout(ctx, c.DBQueryTimeout)
+	defer cancel()
+	return readDB(qctx, db, t)
+}
+
+// withTimeout limits ctx by the timeout if it is set. Without a timeout ctx is returned as is,
+// so the driver does not watch a context that is only ever cancelled after the query is done.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// readDB returns key-value pairs of the config table with lower-cased keys.
+func readDB(ctx context.Context, db *sql.DB, t DBTable) (map[string]interface{}, error) {
+	res := make(map[string]interface{})
+	var key, val string
+
+	q, err := t.query()
+	if err != nil {
+		return nil, err
+	}
+	results, err := db.QueryContext(ctx, q, t.Args...)
+	if err != nil {
+		return nil, fmt.Errorf("can't get key-value pairs from DB: %w", err)
+	}
+	defer results.Close()
+	for results.Next() {
+		err = results.Scan(&key, &val)
+		if err != nil {
+			return nil, fmt.Errorf("can't parse key-value into vars: %w", err)
+		}
+		res[strings.ToLower(key)] = val
+	}
+	if err = results.Err(); err != nil {
+		return nil, fmt.Errorf("can't get key-value pairs from DB: %w", err)
+	}
+	return res, nil
+}
+
+// query builds SELECT of key-value pairs with identifiers quoted for the dialect.
+func (t DBTable) query() (string, error) {
+	t = t.withDefaults()
+	table, err := quoteIdent(t.Dialect, t.Name)
+	if err != nil {
+		return "", err
+	}
+	from := table
+	if t.Schema != "" {
+		schema, err := quoteIdent(t.Dialect, t.Schema)
+		if err != nil {
+			return "", err
+		}
+		from = schema + "." + table
+	}
+	key, err := quoteIdent(t.Dialect, t.KeyColumn)
+	if err != nil {
+		return "", err
+	}
+	value, err := quoteIdent(t.Dialect, t.ValueColumn)
+	if err != nil {
+		return "", err
+	}
+	q := "SELECT " + table + "." + key + ", " + table + "." + value + " FROM " + from
+	if t.Where != "" {
+		if t.Dialect == "" && strings.Contains(t.Where, "?") {
+			return "", fmt.Errorf("filter %q has placeholders, set the SQL dialect", t.Where)
+		}
+		q += " WHERE " + placeholders(t.Dialect, t.Where)
+	}
+	return q, nil
+}
+
+func (t DBTable) withDefaults() DBTable {
+	if t.Name == "" {
+		t.Name = "config"
+	}
+	if t.KeyColumn == "" {
+		t.KeyColumn = "key"
+	}
+	if t.ValueColumn == "" {
+		t.ValueColumn = "value"
+	}
+	return t
+}
+
+// dialectOf returns SQL dialect of the DSN.
+func dialectOf(dsn string) string {
+	return strings.ToLower(strings.SplitN(dsn, "://", 2)[0])
+}
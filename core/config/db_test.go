@@ -0,0 +1,181 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDBTable(t *testing.T) {
+
+	// Имена таблицы, колонок и схемы экранируются согласно диалекту.
+	t.Run("Queries by dialect", func(t *testing.T) {
+		for _, tc := range []struct {
+			table DBTable
+			query string
+		}{
+			{DBTable{}, "SELECT config.key, config.value FROM config"},
+			{DBTable{Schema: "app", Name: "settings", KeyColumn: "k", ValueColumn: "v"}, "SELECT settings.k, settings.v FROM app.settings"},
+			{DBTable{Dialect: "postgres", Schema: "public", Where: "app = ? AND env = ?"}, `SELECT "config"."key", "config"."value" FROM "public"."config" WHERE app = $1 AND env = $2`},
+			{DBTable{Dialect: "mysql", Name: "my`table", Where: "app = ?"}, "SELECT `my``table`.`key`, `my``table`.`value` FROM `my``table` WHERE app = ?"},
+		} {
+			q, err := tc.table.query()
+			require.NoError(t, err)
+			require.Equal(t, tc.query, q)
+		}
+	})
+
+	// Без диалекта допускаются только простые идентификаторы и фильтр без аргументов, неизвестный диалект - ошибка.
+	t.Run("Bad identifiers", func(t *testing.T) {
+		_, err := DBTable{Name: "config; DROP TABLE config"}.query()
+		require.Error(t, err)
+		_, err = DBTable{Dialect: "oracle"}.query()
+		require.Error(t, err)
+		_, err = DBTable{Where: "app = ?"}.query()
+		require.Error(t, err)
+	})
+
+	// Фильтр с аргументами позволяет нескольким сервисам использовать одну таблицу.
+	t.Run("Shared table", func(t *testing.T) {
+		db, mock := newMock()
+		defer db.Close()
+
+		rows := sqlmock.NewRows([]string{"k", "v"})
+		rows.AddRow("section1.varint1", "11")
+
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT "settings"."k", "settings"."v" FROM "shared"."settings" WHERE app = $1 AND env = $2`)).
+			WithArgs("billing", "prod").WillReturnRows(rows)
+		var c TestConf
+		err := New(&c).SetFromDBTable(db, DBTable{
+			Dialect: "postgres", Schema: "shared", Name: "settings", KeyColumn: "k", ValueColumn: "v",
+			Where: "app = ? AND env = ?", Args: []interface{}{"billing", "prod"},
+		})
+		require.NoError(t, err)
+		require.Equal(t, 11, c.Section1.VarInt1)
+	})
+}
+
+func TestDBConnection(t *testing.T) {
+	registerTestDialect(t, "pingmock", Dialect{
+		Driver:    "sqlmock",
+		DriverDSN: func(d DSN) (string, error) { return d.DBName, nil },
+		File:      true,
+	})
+
+	// Недоступная база обнаруживается при подключении, а не при чтении таблицы.
+	t.Run("Ping", func(t *testing.T) {
+		db, mock, err := sqlmock.NewWithDSN("config_ping", sqlmock.MonitorPingsOption(true))
+		require.NoError(t, err)
+		defer db.Close()
+
+		mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+		_, _, err = DialDSN("pingmock://config_ping")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "can't ping DB")
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	// Ошибки базы повторяются с растущей задержкой, пока не кончатся попытки.
+	t.Run("Retry with backoff", func(t *testing.T) {
+		db, mock := newMock()
+		defer db.Close()
+
+		q := regexp.QuoteMeta("SELECT config.key, config.value FROM config")
+		mock.ExpectQuery(q).WillReturnError(errors.New("database is starting up"))
+		mock.ExpectQuery(q).WillReturnError(errors.New("database is starting up"))
+		mock.ExpectQuery(q).WillReturnRows(sqlmock.NewRows([]string{"key", "value"}).AddRow("section1.varint1", "11"))
+		var c TestConf
+		start := time.Now()
+		err := New(&c).Combine(Config{DB: db, DBRetries: 2, DBRetryDelay: 20 * time.Millisecond})
+		require.NoError(t, err)
+		require.GreaterOrEqual(t, int64(time.Since(start)), int64(60*time.Millisecond))
+		require.Equal(t, 11, c.Section1.VarInt1)
+		require.NoError(t, mock.ExpectationsWereMet())
+
+		mock.ExpectQuery(q).WillReturnError(errors.New("database is starting up"))
+		mock.ExpectQuery(q).WillReturnError(errors.New("database is starting up"))
+		err = New(&c).Combine(Config{DB: db, DBRetries: 1, DBRetryDelay: time.Millisecond})
+		require.Error(t, err)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	// Долгий запрос прерывается по таймауту.
+	t.Run("Query timeout", func(t *testing.T) {
+		db, mock := newMock()
+		defer db.Close()
+
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT config.key, config.value FROM config")).
+			WillDelayFor(time.Second).WillReturnRows(sqlmock.NewRows([]string{"key", "value"}))
+		var c TestConf
+		start := time.Now()
+		err := New(&c).Combine(Config{DB: db, DBQueryTimeout: 20 * time.Millisecond})
+		require.Error(t, err)
+		require.Less(t, int64(time.Since(start)), int64(500*time.Millisecond))
+	})
+}
+
+func TestDBContext(t *testing.T) {
+	q := regexp.QuoteMeta("SELECT config.key, config.value FROM config")
+
+	// Дедлайн контекста прерывает зависший запрос.
+	t.Run("SetFromDBContext deadline", func(t *testing.T) {
+		db, mock := newMock()
+		defer db.Close()
+
+		mock.ExpectQuery(q).WillDelayFor(time.Second).WillReturnRows(sqlmock.NewRows([]string{"key", "value"}))
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		var c TestConf
+		start := time.Now()
+		require.Error(t, New(&c).SetFromDBContext(ctx, db, ""))
+		require.Less(t, int64(time.Since(start)), int64(500*time.Millisecond))
+	})
+
+	// Отмена контекста останавливает повторы в CombineContext.
+	t.Run("CombineContext cancels retries", func(t *testing.T) {
+		db, mock := newMock()
+		defer db.Close()
+
+		mock.ExpectQuery(q).WillDelayFor(10 * time.Millisecond).WillReturnError(errors.New("database is starting up"))
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		var c TestConf
+		start := time.Now()
+		err := New(&c).CombineContext(ctx, Config{DB: db, DBRetries: 10, DBRetryDelay: time.Second})
+		require.Error(t, err)
+		require.True(t, errors.Is(err, context.DeadlineExceeded))
+		require.Less(t, int64(time.Since(start)), int64(500*time.Millisecond))
+	})
+
+	// Ошибка посреди чтения строк не дает применить часть таблицы.
+	t.Run("Row error", func(t *testing.T) {
+		db, mock := newMock()
+		defer db.Close()
+
+		rows := sqlmock.NewRows([]string{"key", "value"}).
+			AddRow("section1.varint1", "1").
+			AddRow("section1.varstring1", "first string").
+			RowError(1, context.DeadlineExceeded)
+		mock.ExpectQuery(q).WillReturnRows(rows)
+		var c TestConf
+		err := New(&c).SetFromDBContext(context.Background(), db, "")
+		require.Error(t, err)
+		require.True(t, errors.Is(err, context.DeadlineExceeded))
+		require.Equal(t, 0, c.Section1.VarInt1)
+	})
+
+	// Источники не применяются, если контекст уже отменен.
+	t.Run("Cancelled before start", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		var c TestConf
+		err := New(&c).CombineContext(ctx, Config{Args: []string{"--section1.varint1=11"}})
+		require.True(t, errors.Is(err, context.Canceled))
+		require.Equal(t, 0, c.Section1.VarInt1)
+	})
+}
@@ -0,0 +1,129 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	dotEnvLine   = regexp.MustCompile(`^(?:export\s+)?([A-Za-z_][A-Za-z0-9_.]*)\s*=\s*(.*)$`)
+	dotEnvVarRef = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_.]*)\}`)
+)
+
+// Method adds and replace config fields from .env file, keys are mapped like in SetFromEnv.
+func (s Interface) SetFromDotEnv(fileName, prefix string) error {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return fmt.Errorf("can't open dotenv file: %w", err)
+	}
+	defer f.Close()
+	l, err := ioutil.ReadAll(f)
+	if err != nil {
+		return fmt.Errorf("can't read content of the dotenv file: %w", err)
+	}
+	vars, err := parseDotEnv(bytes.NewReader(l))
+	if err != nil {
+		return fmt.Errorf("can't parse dotenv file: %w", err)
+	}
+	kv := make(map[string]interface{}, len(vars))
+	for k, v := range vars {
+		kv[k] = v
+	}
+	v := reflect.ValueOf(s.str)
+	if v.Kind() != reflect.Ptr {
+		return fmt.Errorf("not a pointer value")
+	}
+	src := mapSource(envStyle, kv)
+	src.origin = fileOrigin(SourceDotEnv, fileName, l, "")
+	src = withFileSuffix(src)
+	return s.decoder().walkField(reflect.Indirect(v), strings.Trim(prefix, "_"), "", "", src)
+}
+
+// parseDotEnv reads KEY=VALUE lines with optional export prefix, quotes, comments and ${VAR} references.
+// References are resolved from previous lines first and from the environment then.
+func parseDotEnv(r io.Reader) (map[string]string, error) {
+	res := make(map[string]string)
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		m := dotEnvLine.FindStringSubmatch(line)
+		if m == nil {
+			return nil, fmt.Errorf("line %d: not in KEY=VALUE form", n)
+		}
+		val, interpolate, err := dotEnvValue(m[2])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		if interpolate {
+			val = dotEnvVarRef.ReplaceAllStringFunc(val, func(ref string) string {
+				name := dotEnvVarRef.FindStringSubmatch(ref)[1]
+				if v, ok := res[name]; ok {
+					return v
+				}
+				return os.Getenv(name)
+			})
+		}
+		res[m[1]] = val
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// dotEnvValue unquotes the raw value and reports whether references must be resolved in it.
+func dotEnvValue(raw string) (string, bool, error) {
+	switch {
+	case strings.HasPrefix(raw, "'"):
+		// Shell form 'it'\''s' is used to put a single quote into the value.
+		var val strings.Builder
+		for {
+			end := strings.Index(raw[1:], "'")
+			if end < 0 {
+				return "", false, fmt.Errorf("unterminated single quote")
+			}
+			val.WriteString(raw[1 : end+1])
+			raw = raw[end+2:]
+			if !strings.HasPrefix(raw, `\''`) {
+				return val.String(), false, nil
+			}
+			val.WriteByte('\'')
+			raw = raw[2:]
+		}
+	case strings.HasPrefix(raw, `"`):
+		end := 1
+		for ; end < len(raw); end++ {
+			if raw[end] == '\\' {
+				end++
+				continue
+			}
+			if raw[end] == '"' {
+				break
+			}
+		}
+		if end >= len(raw) {
+			return "", false, fmt.Errorf("unterminated double quote")
+		}
+		val, err := strconv.Unquote(raw[:end+1])
+		if err != nil {
+			return "", false, fmt.Errorf("bad double quoted value: %w", err)
+		}
+		return val, true, nil
+	default:
+		if i := strings.Index(raw, " #"); i >= 0 {
+			raw = raw[:i]
+		}
+		return strings.TrimSpace(raw), true, nil
+	}
+}
@@ -0,0 +1,75 @@
+package config
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDotEnv(t *testing.T) {
+
+	// Поддерживаются комментарии, export, кавычки и подстановки ${VAR}.
+	t.Run("Dotenv syntax", func(t *testing.T) {
+		require.NoError(t, os.Setenv("DOTENV_HOME", "/home/app"))
+		defer os.Unsetenv("DOTENV_HOME")
+		vars, err := parseDotEnv(strings.NewReader(`
+# comment
+export HOST=localhost # inline comment
+NAME='single ${HOST}'
+GREETING="hello\n${HOST}"
+DIR=${DOTENV_HOME}/data
+EMPTY=
+`))
+		require.NoError(t, err)
+		require.Equal(t, map[string]string{
+			"HOST":     "localhost",
+			"NAME":     "single ${HOST}",
+			"GREETING": "hello\nlocalhost",
+			"DIR":      "/home/app/data",
+			"EMPTY":    "",
+		}, vars)
+	})
+
+	// Если строка не в формате KEY=VALUE или кавычка не закрыта, функция вернет ошибку.
+	t.Run("Bad lines", func(t *testing.T) {
+		_, err := parseDotEnv(strings.NewReader("JUST TEXT"))
+		require.Error(t, err)
+		_, err = parseDotEnv(strings.NewReader(`KEY="unterminated`))
+		require.Error(t, err)
+	})
+}
+
+func TestSetFromDotEnv(t *testing.T) {
+	file, err := ioutil.TempFile("", "env.")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString(`DOT_SECTION1_VARINT1=11
+export DOT_SECTION1_VARSTRING1="first string"
+DOT_SECTION2_VARINT2=22`)
+	file.Sync()
+
+	// Переменные из файла применяются с тем же префиксом, что и окружение, а окружение их переписывает.
+	t.Run("Dotenv file in Combine", func(t *testing.T) {
+		require.NoError(t, os.Setenv("DOT_SECTION2_VARINT2", "33"))
+		defer os.Unsetenv("DOT_SECTION2_VARINT2")
+		var c TestConf
+		err := New(&c).Combine(Config{DotEnvFile: file.Name(), EnvPrefix: "DOT"})
+		require.NoError(t, err)
+		require.Equal(t, 11, c.Section1.VarInt1)
+		require.Equal(t, "first string", c.Section1.VarString1)
+		require.Equal(t, 33, c.Section2.VarInt2)
+	})
+
+	// Если файла не существует, метод вернет ошибку.
+	t.Run("File doesn't exist", func(t *testing.T) {
+		var c TestConf
+		err := New(&c).SetFromDotEnv("dfsdfgsdfds", "DOT")
+		require.Error(t, err)
+	})
+}
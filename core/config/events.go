@@ -0,0 +1,53 @@
+package config
+
+import (
+	"fmt"
+)
+
+// EventKind tells what Combine has done.
+type EventKind string
+
+const (
+	EventSource EventKind = "source" // the source is applied, Origin holds the source and its name
+	EventKey    EventKind = "key"    // the field is set, Path and Origin describe it
+)
+
+// Event is reported by Combine to Config.Logger and Config.OnEvent.
+// Values of the fields are not included, so events are safe to log.
+type Event struct {
+	Kind   EventKind
+	Path   string // field path like Section1.VarInt1, empty for EventSource
+	Origin Origin
+}
+
+func (e Event) String() string {
+	if e.Kind == EventKey {
+		return fmt.Sprintf("config field %s is set from %s", e.Path, e.Origin)
+	}
+	return fmt.Sprintf("config source %s is applied", e.Origin)
+}
+
+// emitter returns the function passing events to c.Logger and c.OnEvent, nil if none of them is set.
+func emitter(c Config) func(Event) {
+	if c.Logger == nil && c.OnEvent == nil {
+		return nil
+	}
+	return func(e Event) {
+		if c.Logger != nil {
+			if e.Kind == EventKey {
+				c.Logger.Debugf("%s", e)
+			} else {
+				c.Logger.Infof("%s", e)
+			}
+		}
+		if c.OnEvent != nil {
+			c.OnEvent(e)
+		}
+	}
+}
+
+func (s Interface) emit(e Event) {
+	if s.events != nil {
+		s.events(e)
+	}
+}
@@ -0,0 +1,73 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testLogger struct {
+	debug, info []string
+}
+
+func (l *testLogger) Debugf(format string, args ...interface{}) {
+	l.debug = append(l.debug, fmt.Sprintf(format, args...))
+}
+
+func (l *testLogger) Infof(format string, args ...interface{}) {
+	l.info = append(l.info, fmt.Sprintf(format, args...))
+}
+func (l *testLogger) Warnf(format string, args ...interface{})  {}
+func (l *testLogger) Errorf(format string, args ...interface{}) {}
+func (l *testLogger) Fatalf(format string, args ...interface{}) {}
+
+type EventConf struct {
+	Section1 struct {
+		VarInt1    int `default:"1"`
+		VarString1 string
+	}
+}
+
+func TestEvents(t *testing.T) {
+
+	// Примененные источники пишутся в лог на уровне info, установленные поля - на уровне debug.
+	t.Run("Logger", func(t *testing.T) {
+		require.NoError(t, os.Setenv("EVT_SECTION1_VARSTRING1", "first string"))
+		defer os.Unsetenv("EVT_SECTION1_VARSTRING1")
+		l := &testLogger{}
+		var kinds []EventKind
+		var c EventConf
+		err := New(&c).Combine(Config{
+			EnvPrefix: "EVT",
+			Args:      []string{"--section1.varint1=11"},
+			Logger:    l,
+			OnEvent:   func(e Event) { kinds = append(kinds, e.Kind) },
+		})
+		require.NoError(t, err)
+		require.Equal(t, []string{"config source env EVT is applied", "config source flags is applied"}, l.info)
+		require.Equal(t, []string{
+			"config field Section1.VarInt1 is set from default",
+			"config field Section1.VarString1 is set from env EVT_SECTION1_VARSTRING1",
+			"config field Section1.VarInt1 is set from flags --section1.varint1",
+		}, l.debug)
+		require.Equal(t, []EventKind{EventKey, EventKey, EventSource, EventKey, EventSource}, kinds)
+	})
+
+	// Без логгера и колбэка Combine ничего не пишет в stdout.
+	t.Run("Silent by default", func(t *testing.T) {
+		r, w, err := os.Pipe()
+		require.NoError(t, err)
+		stdout := os.Stdout
+		os.Stdout = w
+		var c EventConf
+		err = New(&c).Combine(Config{Args: []string{"--section1.varint1=11"}})
+		os.Stdout = stdout
+		w.Close()
+		require.NoError(t, err)
+		out, _ := ioutil.ReadAll(r)
+		require.Empty(t, string(out))
+	})
+}
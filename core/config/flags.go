@@ -0,0 +1,91 @@
+package config
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+)
+
+var flagStyle = keyStyle{tags: []string{"flag", "config"}, sep: ".", upper: false}
+
+// flagValue keeps raw flag value until the config is filled from all parsed flags.
+type flagValue struct {
+	key    string
+	isBool bool
+	kv     map[string]interface{}
+}
+
+func (f *flagValue) String() string {
+	if f == nil || f.kv == nil {
+		return ""
+	}
+	val, _ := f.kv[f.key].(string)
+	return val
+}
+
+func (f *flagValue) Set(val string) error {
+	f.kv[f.key] = val
+	return nil
+}
+
+func (f *flagValue) IsBoolFlag() bool {
+	return f.isBool
+}
+
+// Method adds and replace config fields from command-line flags like --section1.varint1.
+// Flag names are built from the struct like db keys, usage text is taken from desc tag.
+// Flags that are not built from the struct are rejected, so args must hold only config flags,
+// not the own flags of the binary. Nothing is written to stderr, the parse error carries the usage text.
+func (s Interface) SetFromFlags(args []string) error {
+	v := reflect.ValueOf(s.str)
+	if v.Kind() != reflect.Ptr {
+		return fmt.Errorf("not a pointer value")
+	}
+	fs := flag.NewFlagSet("config", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	kv := make(map[string]interface{})
+	s.defineFlags(fs, reflect.Indirect(v).Type(), "", kv, nil)
+	if err := fs.Parse(args); err != nil {
+		var usage bytes.Buffer
+		fs.SetOutput(&usage)
+		fs.PrintDefaults()
+		return fmt.Errorf("can't parse flags: %w, usage:\n%s", err, usage.String())
+	}
+	src := mapSource(flagStyle, kv)
+	src.origin = func(key string) Origin { return Origin{Source: SourceFlags, Name: "--" + key} }
+	return s.decoder().walkField(reflect.Indirect(v), "", "", "", src)
+}
+
+// defineFlags adds flags of the struct fields, seen holds section types on the current path
+// to stop at self-referential types like Next *Node.
+func (s Interface) defineFlags(fs *flag.FlagSet, t reflect.Type, prefix string, kv map[string]interface{}, seen []reflect.Type) {
+	if t.Kind() != reflect.Struct {
+		return
+	}
+	seen = append(seen[:len(seen):len(seen)], t)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, ok := flagStyle.fieldKey(f)
+		if !ok {
+			continue
+		}
+		name = flagStyle.join(prefix, name)
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if isSection(reflect.New(ft).Elem()) && !s.decoder().custom(ft) {
+			if !hasType(seen, ft) {
+				s.defineFlags(fs, ft, name, kv, seen)
+			}
+			continue
+		}
+		usage := f.Tag.Get("desc")
+		if def, ok := f.Tag.Lookup("default"); ok {
+			usage += fmt.Sprintf(" (default %s)", def)
+		}
+		fs.Var(&flagValue{key: name, isBool: ft.Kind() == reflect.Bool, kv: kv}, name, usage)
+	}
+}
@@ -0,0 +1,87 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type FlagsConf struct {
+	Section1 struct {
+		VarInt1    int    `desc:"first int"`
+		VarString1 string `flag:"name"`
+		VarBool1   bool
+	}
+	TLS *struct {
+		Cert string
+	}
+}
+
+func TestSetFromFlags(t *testing.T) {
+
+	// Флаги строятся из полей структуры, bool-флаги могут быть без значения.
+	t.Run("Flags applying", func(t *testing.T) {
+		var c FlagsConf
+		err := New(&c).SetFromFlags([]string{"--section1.varint1=11", "--section1.name", "first string", "--section1.varbool1", "-tls.cert=cert.pem"})
+		require.NoError(t, err)
+		require.Equal(t, 11, c.Section1.VarInt1)
+		require.Equal(t, "first string", c.Section1.VarString1)
+		require.Equal(t, true, c.Section1.VarBool1)
+		require.NotNil(t, c.TLS)
+		require.Equal(t, "cert.pem", c.TLS.Cert)
+	})
+
+	// Если флагов нет, конфиг не меняется, а указатели остаются nil.
+	t.Run("No flags", func(t *testing.T) {
+		var c FlagsConf
+		err := New(&c).SetFromFlags([]string{})
+		require.NoError(t, err)
+		require.Equal(t, FlagsConf{}, c)
+	})
+
+	// Флаги имеют наивысший приоритет в Combine.
+	t.Run("Flags override env", func(t *testing.T) {
+		require.NoError(t, os.Setenv("FLG_SECTION1_VARINT1", "11"))
+		defer os.Unsetenv("FLG_SECTION1_VARINT1")
+		var c FlagsConf
+		err := New(&c).Combine(Config{EnvPrefix: "FLG", Args: []string{"--section1.varint1", "22"}})
+		require.NoError(t, err)
+		require.Equal(t, 22, c.Section1.VarInt1)
+	})
+
+	// Для самоссылающихся типов флаги строятся только до первого повтора типа.
+	t.Run("Self-referential pointers", func(t *testing.T) {
+		var c NodesConf
+		err := New(&c).SetFromFlags([]string{"--head.name=first"})
+		require.NoError(t, err)
+		require.Equal(t, &Node{Name: "first"}, c.Head)
+		err = New(&c).SetFromFlags([]string{"--head.next.name=second"})
+		require.Error(t, err)
+	})
+
+	// Если флаг неизвестен или значение не соответствует типу, метод вернет ошибку с текстом usage,
+	// в stderr при этом ничего не пишется.
+	t.Run("Bad flags", func(t *testing.T) {
+		stderr, err := ioutil.TempFile("", "stderr")
+		require.NoError(t, err)
+		defer os.Remove(stderr.Name())
+		defer stderr.Close()
+		orig := os.Stderr
+		os.Stderr = stderr
+		defer func() { os.Stderr = orig }()
+
+		var c FlagsConf
+		err = New(&c).SetFromFlags([]string{"--unknown=1"})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "flag provided but not defined: -unknown")
+		require.Contains(t, err.Error(), "-section1.varint1")
+		require.Contains(t, err.Error(), "first int")
+		out, err := ioutil.ReadFile(stderr.Name())
+		require.NoError(t, err)
+		require.Empty(t, out)
+		err = New(&c).SetFromFlags([]string{"--section1.varint1=first string"})
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,80 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// FileDecoder decodes the content of a config file into nested maps.
+type FileDecoder func(data []byte) (map[string]interface{}, error)
+
+func defaultFormats() map[string]FileDecoder {
+	return map[string]FileDecoder{
+		"toml": decodeTOML,
+		"yaml": decodeYAML,
+		"yml":  decodeYAML,
+		"json": decodeJSON,
+	}
+}
+
+// formatOf returns format of the file by its extension, TOML is used for unknown ones.
+func formatOf(fileName string, formats map[string]FileDecoder) string {
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(fileName), "."))
+	if _, ok := formats[ext]; ok {
+		return ext
+	}
+	return "toml"
+}
+
+func decodeTOML(data []byte) (map[string]interface{}, error) {
+	m := make(map[string]interface{})
+	if _, err := toml.Decode(string(data), &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func decodeJSON(data []byte) (map[string]interface{}, error) {
+	m := make(map[string]interface{})
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func decodeYAML(data []byte) (map[string]interface{}, error) {
+	m := make(map[interface{}]interface{})
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	res, ok := normalizeYAML(m).(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected YAML document")
+	}
+	return res, nil
+}
+
+// normalizeYAML converts YAML maps with arbitrary keys into maps with string keys.
+func normalizeYAML(val interface{}) interface{} {
+	switch v := val.(type) {
+	case map[interface{}]interface{}:
+		res := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			res[fmt.Sprint(k)] = normalizeYAML(e)
+		}
+		return res
+	case []interface{}:
+		res := make([]interface{}, len(v))
+		for i, e := range v {
+			res[i] = normalizeYAML(e)
+		}
+		return res
+	default:
+		return val
+	}
+}
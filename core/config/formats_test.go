@@ -0,0 +1,117 @@
+package config
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type FormatTagsConf struct {
+	MyKey   string `yaml:"my_key" json:"my_key"`
+	Section struct {
+		OtherKey int `yaml:"other_key" json:"other_key"`
+	}
+}
+
+func TestFileFormats(t *testing.T) {
+	dir, err := ioutil.TempDir("", "conf")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"conf.yaml": `section1:
+  varint1: 11
+  varstring1: first string
+  varbool1: true
+section2:
+  varint2: 22`,
+		"conf.json": `{"section1": {"varint1": 11, "varstring1": "first string", "varbool1": true}, "section2": {"varint2": 22}}`,
+		"conf.txt": `[section1]
+				varint1 = 11
+				varstring1 = "first string"
+				varbool1 = true
+			[section2]
+				varint2 = 22`,
+	}
+	for name, content := range files {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0o600))
+	}
+
+	// Формат файла определяется по расширению, для неизвестных используется TOML.
+	for name := range files {
+		name := name
+		t.Run("Format by extension "+name, func(t *testing.T) {
+			var c TestConf
+			err := New(&c).SetFromFile(filepath.Join(dir, name))
+			require.NoError(t, err)
+			require.Equal(t, 11, c.Section1.VarInt1)
+			require.Equal(t, "first string", c.Section1.VarString1)
+			require.Equal(t, true, c.Section1.VarBool1)
+			require.Equal(t, 22, c.Section2.VarInt2)
+		})
+	}
+
+	// Формат можно задать явно через Config.
+	t.Run("Explicit format", func(t *testing.T) {
+		file := filepath.Join(dir, "conf.cfg")
+		require.NoError(t, ioutil.WriteFile(file, []byte(files["conf.json"]), 0o600))
+		var c TestConf
+		err := New(&c).Combine(Config{ConfigFile: file, ConfigFormat: "json"})
+		require.NoError(t, err)
+		require.Equal(t, 11, c.Section1.VarInt1)
+	})
+
+	// Можно зарегистрировать свой формат.
+	t.Run("Registered format", func(t *testing.T) {
+		file := filepath.Join(dir, "conf.kv")
+		require.NoError(t, ioutil.WriteFile(file, []byte("section1.varint1=11"), 0o600))
+		var c TestConf
+		i := New(&c)
+		i.RegisterFormat("kv", func(data []byte) (map[string]interface{}, error) {
+			kv := strings.SplitN(string(data), "=", 2)
+			return map[string]interface{}{kv[0]: kv[1]}, nil
+		})
+		err := i.SetFromFile(file)
+		require.NoError(t, err)
+		require.Equal(t, 11, c.Section1.VarInt1)
+	})
+
+	// Для YAML и JSON учитываются теги yaml и json, файл сохраняется с теми же ключами.
+	t.Run("Format tags", func(t *testing.T) {
+		for name, content := range map[string]string{
+			"tags.yaml": "my_key: a\nsection:\n  other_key: 1",
+			"tags.json": `{"my_key": "a", "section": {"other_key": 1}}`,
+		} {
+			file := filepath.Join(dir, name)
+			require.NoError(t, ioutil.WriteFile(file, []byte(content), 0o600))
+			var c FormatTagsConf
+			require.NoError(t, New(&c).SetFromFile(file))
+			require.Equal(t, "a", c.MyKey)
+			require.Equal(t, 1, c.Section.OtherKey)
+
+			require.NoError(t, New(&c).SaveToFile(file))
+			data, err := ioutil.ReadFile(file)
+			require.NoError(t, err)
+			require.Contains(t, string(data), "other_key")
+		}
+	})
+
+	// Если формат неизвестен или типы перепутаны, метод вернет ошибку.
+	t.Run("Unknown format and bad types", func(t *testing.T) {
+		var c TestConf
+		err := New(&c).SetFromFileFormat(filepath.Join(dir, "conf.json"), "hcl")
+		require.Error(t, err)
+
+		file := filepath.Join(dir, "bad.json")
+		require.NoError(t, ioutil.WriteFile(file, []byte(`{"section1": {"varint1": 1.5}}`), 0o600))
+		err = New(&c).SetFromFile(file)
+		require.Error(t, err)
+	})
+}
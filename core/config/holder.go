@@ -0,0 +1,41 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sync/atomic"
+)
+
+// Holder keeps immutable snapshots of a config struct and swaps them atomically,
+// so readers never race with reloads.
+type Holder struct {
+	typ  reflect.Type
+	snap atomic.Value
+}
+
+// NewHolder returns holder with a snapshot of the config struct pointed by str.
+func NewHolder(str interface{}) (*Holder, error) {
+	v := reflect.ValueOf(str)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return nil, fmt.Errorf("not a pointer value")
+	}
+	h := &Holder{typ: v.Type()}
+	h.snap.Store(deepCopy(v))
+	return h, nil
+}
+
+// Load returns a copy of the current snapshot, the pointer of the same type as passed to NewHolder.
+// Changes of the copy do not affect the snapshot.
+func (h *Holder) Load() interface{} {
+	return deepCopy(h.snap.Load().(reflect.Value)).Interface()
+}
+
+// Store atomically replaces the snapshot with a copy of str.
+func (h *Holder) Store(str interface{}) error {
+	v := reflect.ValueOf(str)
+	if !v.IsValid() || v.Type() != h.typ || v.IsNil() {
+		return fmt.Errorf("can't store %T in holder of %s", str, h.typ)
+	}
+	h.snap.Store(deepCopy(v))
+	return nil
+}
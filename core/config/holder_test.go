@@ -0,0 +1,103 @@
+package config
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHolder(t *testing.T) {
+
+	// Load возвращает копию, изменения которой не влияют на снимок.
+	t.Run("Snapshots are immutable", func(t *testing.T) {
+		c := CollectionsConf{Hosts: []string{"a"}, Labels: map[string]string{"env": "prod"}}
+		h, err := NewHolder(&c)
+		require.NoError(t, err)
+		c.Hosts[0] = "b"
+		snap := h.Load().(*CollectionsConf)
+		require.Equal(t, []string{"a"}, snap.Hosts)
+		snap.Labels["env"] = "dev"
+		require.Equal(t, map[string]string{"env": "prod"}, h.Load().(*CollectionsConf).Labels)
+	})
+
+	// Store принимает только указатель на тип, с которым создан holder.
+	t.Run("Type mismatch", func(t *testing.T) {
+		h, err := NewHolder(&TestConf{})
+		require.NoError(t, err)
+		require.Error(t, h.Store(&CollectionsConf{}))
+		require.Error(t, h.Store(nil))
+		require.Error(t, h.Store((*TestConf)(nil)))
+		_, err = NewHolder(TestConf{})
+		require.Error(t, err)
+	})
+
+	// Если в New передан не указатель, holder не создается, а Combine возвращает ошибку.
+	t.Run("Not a pointer", func(t *testing.T) {
+		i := New(TestConf{})
+		require.Nil(t, i.Holder())
+		require.Error(t, i.Combine(Config{}))
+	})
+
+	// Параллельные чтение и запись не приводят к гонкам (проверяется с -race).
+	t.Run("Concurrent access", func(t *testing.T) {
+		h, err := NewHolder(&TestConf{})
+		require.NoError(t, err)
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(2)
+			go func(i int) {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					c := TestConf{}
+					c.Section1.VarInt1 = i*100 + j
+					if err := h.Store(&c); err != nil {
+						t.Error(err)
+					}
+				}
+			}(i)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					c := h.Load().(*TestConf)
+					c.Section1.VarString1 = "changed"
+				}
+			}()
+		}
+		wg.Wait()
+		require.Equal(t, "", h.Load().(*TestConf).Section1.VarString1)
+	})
+
+	// Снимки обновляются после Combine и при перечитывании в Watch без гонок с читателями.
+	t.Run("Holder of Interface", func(t *testing.T) {
+		file, err := ioutil.TempFile("", "conf.")
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer os.Remove(file.Name())
+		require.NoError(t, ioutil.WriteFile(file.Name(), []byte("[section1]\nvarint1 = 11"), 0o600))
+
+		var c TestConf
+		i := New(&c)
+		conf := Config{ConfigFile: file.Name(), WatchInterval: time.Millisecond}
+		require.NoError(t, i.Combine(conf))
+		require.Equal(t, 11, i.Holder().Load().(*TestConf).Section1.VarInt1)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		i.Watch(ctx, conf)
+		replaceFile(t, file.Name(), "[section1]\nvarint1 = 22", time.Minute)
+		deadline := time.Now().Add(time.Second)
+		for i.Holder().Load().(*TestConf).Section1.VarInt1 != 22 {
+			if time.Now().After(deadline) {
+				t.Fatal("snapshot was not updated")
+			}
+			time.Sleep(time.Millisecond)
+		}
+	})
+}
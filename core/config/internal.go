@@ -1,88 +1,610 @@
 package config
 
 import (
+	"crypto/cipher"
+	"encoding"
 	"fmt"
 	"os"
 	"reflect"
 	"strconv"
 	"strings"
+	"time"
 )
 
-func getEnvVar(v reflect.Value, t reflect.Type, counter int, prefix string) error {
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// decoder converts raw source values into the config fields.
+type decoder struct {
+	hooks  map[reflect.Type]DecodeHook
+	prov   *provenance
+	style  keyStyle    // key style of the current source for tables in arrays
+	aead   cipher.AEAD // decrypts enc: values if set
+	events func(Event) // receives set fields if set
+}
+
+// record saves the origin of the field value if the source knows it.
+func (d decoder) record(path, key string, src source) {
+	if src.origin != nil {
+		d.note(path, src.origin(key))
+	}
+}
+
+// note saves the origin of the field value and reports the field as set.
+func (d decoder) note(path string, o Origin) {
+	if d.prov != nil {
+		d.prov.set(path, o)
+	}
+	if d.events != nil {
+		d.events(Event{Kind: EventKey, Path: path, Origin: o})
+	}
+}
+
+func joinPath(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
+
+// custom reports whether the type is decoded by a hook or by its UnmarshalText method.
+func (d decoder) custom(t reflect.Type) bool {
+	if _, ok := d.hooks[t]; ok {
+		return true
+	}
+	return reflect.PtrTo(t).Implements(textUnmarshalerType)
+}
+
+func (d decoder) decodeCustom(val string, v *reflect.Value) error {
+	if hook, ok := d.hooks[v.Type()]; ok {
+		res, err := hook(val)
+		if err != nil {
+			return fmt.Errorf("could not decode %s: %w", v.Type(), err)
+		}
+		rv := reflect.ValueOf(res)
+		if !rv.IsValid() || !rv.Type().AssignableTo(v.Type()) {
+			return fmt.Errorf("decode hook for %s returned %T", v.Type(), res)
+		}
+		v.Set(rv)
+		return nil
+	}
+	if err := v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(val)); err != nil {
+		return fmt.Errorf("could not unmarshal %s: %w", v.Type(), err)
+	}
+	return nil
+}
+
+// keyStyle describes how a source builds lookup keys from struct fields.
+type keyStyle struct {
+	tags    []string // tags overriding the field name, by priority
+	sep     string   // separator between nested key segments
+	upper   bool     // field names are upper-cased, otherwise lower-cased
+	promote bool     // fields of untagged embedded structs are keyed as fields of the parent like in toml and json
+}
+
+var (
+	envStyle  = keyStyle{tags: []string{"env", "config"}, sep: "_", upper: true}
+	dbStyle   = keyStyle{tags: []string{"db", "config"}, sep: ".", upper: false}
+	fileStyle = keyStyle{tags: []string{"config", "toml"}, sep: ".", upper: false, promote: true}
+)
+
+// formatStyle returns key style of the file format, the tag named after the format like yaml:"name" is used after config tag.
+func formatStyle(format string) keyStyle {
+	format = strings.ToLower(format)
+	if format == "yml" {
+		format = "yaml"
+	}
+	ks := fileStyle
+	ks.tags = []string{"config", format}
+	return ks
+}
+
+// promoted reports whether fields of the embedded struct are keyed as fields of the parent.
+func (ks keyStyle) promoted(f reflect.StructField) bool {
+	if !ks.promote || !f.Anonymous {
+		return false
+	}
+	for _, tag := range ks.tags {
+		if name := strings.Split(f.Tag.Get(tag), ",")[0]; name != "" {
+			return false
+		}
+	}
+	t := f.Type
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return isSection(reflect.New(t).Elem())
+}
+
+// fieldKey returns key segment for the struct field or false if the field must be skipped.
+// Env tag values are used as is, other sources match keys case-insensitively.
+func (ks keyStyle) fieldKey(f reflect.StructField) (string, bool) {
+	if f.PkgPath != "" && !f.Anonymous {
+		return "", false
+	}
+	for _, tag := range ks.tags {
+		val, ok := f.Tag.Lookup(tag)
+		if !ok {
+			continue
+		}
+		name := strings.Split(val, ",")[0]
+		switch {
+		case name == "-":
+			return "", false
+		case name == "":
+			continue
+		case !ks.upper:
+			return strings.ToLower(name), true
+		default:
+			return name, true
+		}
+	}
+	if ks.upper {
+		return strings.ToUpper(f.Name), true
+	}
+	return strings.ToLower(f.Name), true
+}
+
+func (ks keyStyle) join(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + ks.sep + name
+}
+
+// source gives access to the key-value pairs of one config source.
+type source struct {
+	style  keyStyle
+	lookup func(key string) (interface{}, bool)
+	keys   func() []string
+	origin func(key string) Origin
+	alloc  []reflect.Type // types of nil pointers being allocated on the current path
+}
+
+// allocating reports whether nil pointer of the type is already being allocated on the current path.
+func (src source) allocating(t reflect.Type) bool {
+	return hasType(src.alloc, t)
+}
+
+func envSource() source {
+	return source{
+		style:  envStyle,
+		lookup: func(key string) (interface{}, bool) { return os.LookupEnv(key) },
+		origin: func(key string) Origin { return Origin{Source: SourceEnv, Name: key} },
+		keys: func() []string {
+			env := os.Environ()
+			res := make([]string, 0, len(env))
+			for _, e := range env {
+				res = append(res, strings.SplitN(e, "=", 2)[0])
+			}
+			return res
+		},
+	}
+}
+
+func mapSource(ks keyStyle, kv map[string]interface{}) source {
+	return source{
+		style: ks,
+		lookup: func(key string) (interface{}, bool) {
+			val, ok := kv[key]
+			return val, ok
+		},
+		keys: func() []string {
+			res := make([]string, 0, len(kv))
+			for k := range kv {
+				res = append(res, k)
+			}
+			return res
+		},
+	}
+}
+
+// subKeys returns the rest of the keys nested into the prefix.
+func (src source) subKeys(prefix string) []string {
+	var res []string
+	prefix += src.style.sep
+	for _, k := range src.keys() {
+		if strings.HasPrefix(k, prefix) && len(k) > len(prefix) {
+			res = append(res, k[len(prefix):])
+		}
+	}
+	return res
+}
+
+func getEnvVar(d decoder, v reflect.Value, prefix string) error {
 	if v.Kind() != reflect.Ptr {
 		return fmt.Errorf("not a pointer value")
 	}
-	f := reflect.StructField{}
-	if counter != -1 {
-		f = t.Field(counter)
+	prefix = strings.Trim(prefix, "_")
+	return d.walkField(reflect.Indirect(v), prefix, "", "", withFileSuffix(envSource()))
+}
+
+func parseToStruct(d decoder, v reflect.Value, src source) error {
+	if v.Kind() != reflect.Ptr {
+		return fmt.Errorf("not a pointer value")
 	}
-	v = reflect.Indirect(v)
-	fName := strings.ToUpper(f.Name)
-	if prefix != "" {
-		prefix = strings.TrimLeft(prefix, "_")
+	return d.walkField(reflect.Indirect(v), "", "", "", src)
+}
+
+// flatten converts nested maps into the map with dotted lower-cased keys.
+func flatten(prefix string, m map[string]interface{}, kv map[string]interface{}) {
+	for k, val := range m {
+		key := fileStyle.join(prefix, strings.ToLower(k))
+		if sub, ok := val.(map[string]interface{}); ok {
+			flatten(key, sub, kv)
+			continue
+		}
+		kv[key] = val
 	}
+}
 
-	env := os.Getenv(prefix + fName)
-	if err := selector(env, &v); err != nil {
-		return fmt.Errorf("could set value: %w", err)
+func (d decoder) setDefaults(v reflect.Value, path string) error {
+	if v.Kind() != reflect.Struct {
+		return nil
 	}
-	if v.Kind() == reflect.Struct {
-		for i := 0; i < v.NumField(); i++ {
-			if err := getEnvVar(v.Field(i).Addr(), v.Type(), i, prefix+fName+"_"); err != nil {
-				return fmt.Errorf("could not apply env var: %w", err)
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		if f.PkgPath != "" && !f.Anonymous {
+			continue
+		}
+		fv := v.Field(i)
+		if fv.Kind() == reflect.Ptr {
+			if _, ok := f.Tag.Lookup("default"); ok && fv.IsNil() {
+				fv.Set(reflect.New(fv.Type().Elem()))
+			}
+			fv = reflect.Indirect(fv)
+			if !fv.IsValid() {
+				continue
+			}
+		}
+		if def, ok := f.Tag.Lookup("default"); ok {
+			if err := d.setValue(def, fv, f.Tag); err != nil {
+				return fmt.Errorf("could not set default value of %s: %w", f.Name, err)
+			}
+			d.note(joinPath(path, f.Name), Origin{Source: SourceDefault})
+		}
+		if isSection(fv) {
+			if err := d.setDefaults(fv, joinPath(path, f.Name)); err != nil {
+				return fmt.Errorf("%s: %w", f.Name, err)
 			}
 		}
 	}
 	return nil
 }
 
-func parseToStruct(v reflect.Value, t reflect.Type, counter int, prefix string, kv map[string]string) error {
-	if v.Kind() != reflect.Ptr {
-		return fmt.Errorf("not a pointer value")
+func (d decoder) walkStruct(v reflect.Value, prefix, path string, src source) error {
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		name, ok := src.style.fieldKey(f)
+		if !ok {
+			continue
+		}
+		if src.style.promoted(f) {
+			if err := d.walkField(v.Field(i), prefix, joinPath(path, f.Name), "", src); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := d.walkField(v.Field(i), src.style.join(prefix, name), joinPath(path, f.Name), f.Tag, src); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d decoder) walkField(v reflect.Value, key, path string, tag reflect.StructTag, src source) error {
+	if v.Kind() == reflect.Ptr {
+		return d.walkPointer(v, key, path, tag, src)
 	}
-	f := reflect.StructField{}
-	if counter != -1 {
-		f = t.Field(counter)
+	custom := d.custom(v.Type())
+	if isSection(v) && !custom {
+		return d.walkStruct(v, key, path, src)
 	}
-	v = reflect.Indirect(v)
-	fName := strings.ToLower(f.Name)
-	if prefix != "" {
-		prefix = strings.TrimLeft(prefix, ".")
+	if val, ok := src.lookup(key); ok {
+		d.style = src.style
+		if err := d.setValue(val, v, tag); err != nil {
+			return fmt.Errorf("could not set value of %s: %w", key, err)
+		}
+		d.record(path, key, src)
 	}
+	if custom {
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Slice:
+		return d.walkIndexed(v, key, path, tag, src)
+	case reflect.Map:
+		return d.walkMapKeys(v, key, path, tag, src)
+	}
+	return nil
+}
 
-	env := kv[prefix+fName]
-	if err := selector(env, &v); err != nil {
-		return fmt.Errorf("could set value: %w", err)
+// walkPointer allocates nil pointer only if the source has a key for it or any nested field.
+func (d decoder) walkPointer(v reflect.Value, key, path string, tag reflect.StructTag, src source) error {
+	if !v.IsNil() {
+		return d.walkField(v.Elem(), key, path, tag, src)
+	}
+	t := v.Type().Elem()
+	if src.allocating(t) {
+		// Self-referential type like Next *Node: go deeper only while the source has keys for it.
+		if _, ok := src.lookup(key); !ok && len(src.subKeys(key)) == 0 {
+			return nil
+		}
+	}
+	src.alloc = append(src.alloc[:len(src.alloc):len(src.alloc)], t)
+	hit := false
+	lookup := src.lookup
+	src.lookup = func(k string) (interface{}, bool) {
+		val, ok := lookup(k)
+		hit = hit || ok
+		return val, ok
+	}
+	// Defaults and keys of tmp are noted only if the pointer is set, so they are held back until then.
+	var held []Event
+	td := d
+	td.prov = nil
+	td.events = func(e Event) { held = append(held, e) }
+	tmp := reflect.New(v.Type().Elem())
+	if isSection(tmp.Elem()) {
+		if err := td.setDefaults(tmp.Elem(), path); err != nil {
+			return fmt.Errorf("could not set default values of %s: %w", key, err)
+		}
+	}
+	if err := td.walkField(tmp.Elem(), key, path, tag, src); err != nil {
+		return err
+	}
+	if hit {
+		v.Set(tmp)
+		for _, e := range held {
+			d.note(e.Path, e.Origin)
+		}
+	}
+	return nil
+}
+
+// walkIndexed fills the slice from indexed keys like APP_HOSTS_0, APP_HOSTS_1.
+// Indices must go in a row from 0, so the slice length is bounded by the number of keys.
+func (d decoder) walkIndexed(v reflect.Value, key, path string, tag reflect.StructTag, src source) error {
+	indices := make(map[int]bool)
+	for _, k := range src.subKeys(key) {
+		seg := strings.SplitN(k, src.style.sep, 2)[0]
+		if i, err := strconv.Atoi(seg); err == nil && i >= 0 && strconv.Itoa(i) == seg {
+			indices[i] = true
+		}
+	}
+	n := len(indices)
+	if n == 0 {
+		return nil
+	}
+	for i := 0; i < n; i++ {
+		if !indices[i] {
+			return fmt.Errorf("could not set value of %s: index %d is missing", key, i)
+		}
+	}
+	res := reflect.MakeSlice(v.Type(), n, n)
+	for i := 0; i < n; i++ {
+		if err := d.walkField(res.Index(i), src.style.join(key, strconv.Itoa(i)), fmt.Sprintf("%s[%d]", path, i), tag, src); err != nil {
+			return err
+		}
+	}
+	v.Set(res)
+	return nil
+}
+
+// walkMapKeys fills the map from nested keys like section.labels.name.
+func (d decoder) walkMapKeys(v reflect.Value, key, path string, tag reflect.StructTag, src source) error {
+	sub := src.subKeys(key)
+	if len(sub) == 0 {
+		return nil
+	}
+	if v.IsNil() {
+		v.Set(reflect.MakeMap(v.Type()))
+	}
+	for _, k := range sub {
+		val, _ := src.lookup(src.style.join(key, k))
+		val, err := d.resolve(val, tag)
+		if err != nil {
+			return fmt.Errorf("could not set value of %s: %w", src.style.join(key, k), err)
+		}
+		if err := d.setEntry(v, k, val); err != nil {
+			return fmt.Errorf("could not set value of %s: %w", src.style.join(key, k), err)
+		}
+		d.record(path, src.style.join(key, k), src)
+	}
+	return nil
+}
+
+// setValue sets the value, splitting strings into slices and maps by the separator of sep tag.
+func (d decoder) setValue(val interface{}, v reflect.Value, tag reflect.StructTag) error {
+	val, err := d.resolve(val, tag)
+	if err != nil {
+		return err
+	}
+	str, ok := val.(string)
+	if !ok || str == "" || (v.Kind() != reflect.Slice && v.Kind() != reflect.Map) || d.custom(v.Type()) {
+		return d.selector(val, &v)
 	}
-	if v.Kind() == reflect.Struct {
-		for i := 0; i < v.NumField(); i++ {
-			if err := parseToStruct(v.Field(i).Addr(), v.Type(), i, prefix+fName+".", kv); err != nil {
-				return fmt.Errorf("could not apply env var: %w", err)
+	sep := tag.Get("sep")
+	if sep == "" {
+		sep = ","
+	}
+	parts := strings.Split(str, sep)
+	if v.Kind() == reflect.Slice {
+		res := reflect.MakeSlice(v.Type(), len(parts), len(parts))
+		for i, p := range parts {
+			elem := res.Index(i)
+			if err := d.selector(strings.TrimSpace(p), &elem); err != nil {
+				return fmt.Errorf("element %d: %w", i, err)
 			}
 		}
+		v.Set(res)
+		return nil
+	}
+	res := reflect.MakeMap(v.Type())
+	for _, p := range parts {
+		kv := strings.SplitN(p, "=", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("map entry %q is not in k=v form", p)
+		}
+		if err := d.setEntry(res, strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])); err != nil {
+			return err
+		}
+	}
+	v.Set(res)
+	return nil
+}
+
+func (d decoder) setEntry(m reflect.Value, key string, val interface{}) error {
+	k := reflect.New(m.Type().Key()).Elem()
+	if err := d.selector(key, &k); err != nil {
+		return fmt.Errorf("map key %q: %w", key, err)
+	}
+	e := reflect.New(m.Type().Elem()).Elem()
+	if err := d.selector(val, &e); err != nil {
+		return fmt.Errorf("map value of %q: %w", key, err)
+	}
+	m.SetMapIndex(k, e)
+	return nil
+}
+
+// isSection reports whether the value is a nested struct rather than a scalar.
+func isSection(v reflect.Value) bool {
+	return v.Kind() == reflect.Struct && !reflect.PtrTo(v.Type()).Implements(textUnmarshalerType)
+}
+
+func hasType(types []reflect.Type, t reflect.Type) bool {
+	for _, a := range types {
+		if a == t {
+			return true
+		}
+	}
+	return false
+}
+
+func (d decoder) selector(val interface{}, v *reflect.Value) error {
+	env, ok := val.(string)
+	if !ok {
+		return d.assign(val, v)
+	}
+	if env == "" {
+		return nil
+	}
+	if d.custom(v.Type()) {
+		return d.decodeCustom(env, v)
+	}
+	if v.Type() == durationType {
+		dur, err := time.ParseDuration(env)
+		if err != nil {
+			return fmt.Errorf("could not parse duration: %w", err)
+		}
+		v.SetInt(int64(dur))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		envI, err := strconv.ParseInt(env, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("could not parse to %s: %w", v.Type(), err)
+		}
+		v.SetInt(envI)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		envU, err := strconv.ParseUint(env, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("could not parse to %s: %w", v.Type(), err)
+		}
+		v.SetUint(envU)
+	case reflect.Float32, reflect.Float64:
+		envF, err := strconv.ParseFloat(env, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("could not parse to %s: %w", v.Type(), err)
+		}
+		v.SetFloat(envF)
+	case reflect.String:
+		v.SetString(env)
+	case reflect.Bool:
+		envB, err := strconv.ParseBool(env)
+		if err != nil {
+			return fmt.Errorf("could not parse bool: %w", err)
+		}
+		v.SetBool(envB)
+	case reflect.Array, reflect.Chan, reflect.Complex128, reflect.Complex64, reflect.Func, reflect.Interface, reflect.Invalid, reflect.Map, reflect.Ptr, reflect.Slice, reflect.Struct, reflect.UnsafePointer:
+		return fmt.Errorf("unsupported type %s", v.Type())
 	}
 	return nil
 }
 
-func selector(env string, v *reflect.Value) error {
-	if env != "" {
+// assign sets already typed value, e.g. decoded from a file.
+func (d decoder) assign(val interface{}, v *reflect.Value) error {
+	rv := reflect.ValueOf(val)
+	switch {
+	case !rv.IsValid():
+		return nil
+	case rv.Type().AssignableTo(v.Type()):
+		v.Set(rv)
+		return nil
+	}
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice {
+			return d.assignSlice(rv, v)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
 		switch v.Kind() {
-		case reflect.Int:
-			envI, err := strconv.Atoi(env)
-			if err != nil {
-				return fmt.Errorf("could not parse to int: %w", err)
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if v.OverflowInt(rv.Int()) {
+				return fmt.Errorf("value %d overflows %s", rv.Int(), v.Type())
 			}
-			v.SetInt(int64(envI))
-		case reflect.String:
-			v.SetString(env)
-		case reflect.Bool:
-			envB, err := strconv.ParseBool(env)
-			if err != nil {
-				return fmt.Errorf("could not parse bool: %w", err)
+			v.SetInt(rv.Int())
+			return nil
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			if rv.Int() < 0 || v.OverflowUint(uint64(rv.Int())) {
+				return fmt.Errorf("value %d overflows %s", rv.Int(), v.Type())
 			}
-			v.SetBool(envB)
-		case reflect.Array, reflect.Chan, reflect.Complex128, reflect.Complex64, reflect.Float32, reflect.Float64, reflect.Func, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Int8, reflect.Interface, reflect.Invalid, reflect.Map, reflect.Ptr, reflect.Slice, reflect.Struct, reflect.Uint, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uint8, reflect.Uintptr, reflect.UnsafePointer:
+			v.SetUint(uint64(rv.Int()))
+			return nil
+		case reflect.Float32, reflect.Float64:
+			v.SetFloat(float64(rv.Int()))
+			return nil
+		}
+	case reflect.Float32, reflect.Float64:
+		if f := rv.Float(); f == float64(int64(f)) && v.Kind() != reflect.Float32 && v.Kind() != reflect.Float64 {
+			return d.assign(int64(f), v)
+		}
+		if v.Kind() == reflect.Float32 || v.Kind() == reflect.Float64 {
+			if v.OverflowFloat(rv.Float()) {
+				return fmt.Errorf("value %v overflows %s", rv.Float(), v.Type())
+			}
+			v.SetFloat(rv.Float())
+			return nil
+		}
+	}
+	return fmt.Errorf("can't use %s as %s", rv.Type(), v.Type())
+}
+
+// assignSlice converts decoded array element by element, tables become nested structs.
+func (d decoder) assignSlice(rv reflect.Value, v *reflect.Value) error {
+	res := reflect.MakeSlice(v.Type(), rv.Len(), rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		elem := res.Index(i)
+		val := rv.Index(i).Interface()
+		if m, ok := val.(map[string]interface{}); ok && isSection(elem) {
+			kv := make(map[string]interface{})
+			flatten("", m, kv)
+			style := d.style
+			if style.sep == "" {
+				style = fileStyle
+			}
+			if err := d.walkStruct(elem, "", "", mapSource(style, kv)); err != nil {
+				return fmt.Errorf("element %d: %w", i, err)
+			}
+			continue
+		}
+		if err := d.selector(val, &elem); err != nil {
+			return fmt.Errorf("element %d: %w", i, err)
 		}
 	}
+	v.Set(res)
 	return nil
 }
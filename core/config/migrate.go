@@ -0,0 +1,88 @@
+package config
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+)
+
+// Function creates the config table described by t if it does not exist.
+// Besides key and value columns the table has description, updated_at and updated_by columns.
+// t.Dialect must be postgres or mysql like the scheme of the DSN, tables with t.Where filter are not supported.
+func CreateTable(db *sql.DB, t DBTable) error {
+	q, err := t.create()
+	if err != nil {
+		return err
+	}
+	if _, err = db.Exec(q); err != nil {
+		return fmt.Errorf("can't create config table: %w", err)
+	}
+	return nil
+}
+
+// Method inserts default values of the config fields into the config table of db.
+// Every key gets the description from desc tag, existing keys are left untouched,
+// so seeding can be repeated after new fields are added to the struct.
+func (s Interface) SeedDB(db *sql.DB, t DBTable, updatedBy string) error {
+	q, err := t.seed()
+	if err != nil {
+		return err
+	}
+	v := reflect.ValueOf(s.str)
+	if v.Kind() != reflect.Ptr {
+		return fmt.Errorf("not a pointer value")
+	}
+	def := reflect.New(reflect.Indirect(v).Type()).Elem()
+	if err = (decoder{hooks: s.hooks, aead: s.keys.get()}).setDefaults(def, ""); err != nil {
+		return fmt.Errorf("can't apply default values: %w", err)
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("can't begin transaction: %w", err)
+	}
+	err = pairs(def, "", dbStyle, s.sealer(), false, func(key, val string, f reflect.StructField) error {
+		if _, err := tx.Exec(q, key, val, f.Tag.Get("desc"), updatedBy); err != nil {
+			return fmt.Errorf("can't seed %s: %w", key, err)
+		}
+		return nil
+	})
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("can't commit transaction: %w", err)
+	}
+	return nil
+}
+
+// create builds CREATE TABLE of the config table for the dialect.
+func (t DBTable) create() (string, error) {
+	table, key, value, err := t.names()
+	if err != nil {
+		return "", err
+	}
+	updatedAt := "updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP"
+	if t.Dialect == "mysql" {
+		updatedAt += " ON UPDATE CURRENT_TIMESTAMP"
+	}
+	return "CREATE TABLE IF NOT EXISTS " + table + " (" +
+		key + " VARCHAR(255) NOT NULL PRIMARY KEY, " +
+		value + " TEXT NOT NULL, " +
+		"description TEXT, " +
+		updatedAt + ", " +
+		"updated_by VARCHAR(255))", nil
+}
+
+// seed builds INSERT of one row which is ignored if the key exists.
+func (t DBTable) seed() (string, error) {
+	table, key, value, err := t.names()
+	if err != nil {
+		return "", err
+	}
+	q := "INSERT INTO " + table + " (" + key + ", " + value + ", description, updated_by) VALUES "
+	if t.Dialect == "postgres" {
+		return q + "($1, $2, $3, $4) ON CONFLICT (" + key + ") DO NOTHING", nil
+	}
+	return q + "(?, ?, ?, ?) ON DUPLICATE KEY UPDATE " + key + " = " + key, nil
+}
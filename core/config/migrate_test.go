@@ -0,0 +1,74 @@
+package config
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+)
+
+type SeedConf struct {
+	Section1 struct {
+		VarInt1    int    `default:"11" desc:"first int"`
+		VarString1 string `default:"str"`
+	}
+	Hosts []string `default:"a,b"`
+}
+
+func TestCreateTable(t *testing.T) {
+
+	// Таблица создается с колонками описания и времени изменения для каждого диалекта.
+	t.Run("DDL by dialect", func(t *testing.T) {
+		for _, tc := range []struct {
+			table DBTable
+			query string
+		}{
+			{DBTable{Dialect: "postgres"}, `CREATE TABLE IF NOT EXISTS "config" ("key" VARCHAR(255) NOT NULL PRIMARY KEY, "value" TEXT NOT NULL, description TEXT, updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP, updated_by VARCHAR(255))`},
+			{DBTable{Dialect: "mysql", Schema: "app", Name: "settings"}, "CREATE TABLE IF NOT EXISTS `app`.`settings` (`key` VARCHAR(255) NOT NULL PRIMARY KEY, `value` TEXT NOT NULL, description TEXT, updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP, updated_by VARCHAR(255))"},
+		} {
+			q, err := tc.table.create()
+			require.NoError(t, err)
+			require.Equal(t, tc.query, q)
+		}
+		_, err := DBTable{}.create()
+		require.Error(t, err)
+	})
+
+	t.Run("Exec", func(t *testing.T) {
+		db, mock := newMock()
+		defer db.Close()
+
+		mock.ExpectExec(regexp.QuoteMeta(`CREATE TABLE IF NOT EXISTS "config"`)).WillReturnResult(sqlmock.NewResult(0, 0))
+		require.NoError(t, CreateTable(db, DBTable{Dialect: "postgres"}))
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestSeedDB(t *testing.T) {
+
+	// В таблицу пишутся значения по умолчанию, а не текущие значения структуры.
+	t.Run("Defaults with descriptions", func(t *testing.T) {
+		db, mock := newMock()
+		defer db.Close()
+
+		q := regexp.QuoteMeta(`INSERT INTO "config" ("key", "value", description, updated_by) VALUES ($1, $2, $3, $4) ON CONFLICT ("key") DO NOTHING`)
+		mock.ExpectBegin()
+		mock.ExpectExec(q).WithArgs("section1.varint1", "11", "first int", "admin").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(q).WithArgs("section1.varstring1", "str", "", "admin").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(q).WithArgs("hosts", "a,b", "", "admin").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
+		var c SeedConf
+		c.Section1.VarInt1 = 42
+		require.NoError(t, New(&c).SeedDB(db, DBTable{Dialect: "postgres"}, "admin"))
+		require.NoError(t, mock.ExpectationsWereMet())
+		require.Equal(t, 42, c.Section1.VarInt1)
+	})
+
+	// Для MySQL существующие ключи не изменяются.
+	t.Run("MySQL", func(t *testing.T) {
+		q, err := DBTable{Dialect: "mysql"}.seed()
+		require.NoError(t, err)
+		require.Equal(t, "INSERT INTO `config` (`key`, `value`, description, updated_by) VALUES (?, ?, ?, ?) ON DUPLICATE KEY UPDATE `key` = `key`", q)
+	})
+}
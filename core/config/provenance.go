@@ -0,0 +1,140 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Source names a config source applied by Combine.
+type Source string
+
+const (
+	SourceDefault Source = "default"
+	SourceFile    Source = "file"
+	SourceDotEnv  Source = "dotenv"
+	SourceEnv     Source = "env"
+	SourceDB      Source = "db"
+	SourceFlags   Source = "flags"
+)
+
+// DefaultSources is the order of sources used by Combine if Config.Sources is empty.
+var DefaultSources = []Source{SourceFile, SourceDotEnv, SourceEnv, SourceDB, SourceFlags}
+
+// Origin describes where the value of a config field came from.
+type Origin struct {
+	Source Source
+	Name   string // file path, env var name, db key or flag name
+	Key    string // key inside the file
+	Line   int    // line in the file, 0 if unknown
+}
+
+func (o Origin) String() string {
+	switch {
+	case o.Name == "":
+		return string(o.Source)
+	case o.Line > 0:
+		return fmt.Sprintf("%s %s:%d (%s)", o.Source, o.Name, o.Line, o.Key)
+	case o.Key != "":
+		return fmt.Sprintf("%s %s (%s)", o.Source, o.Name, o.Key)
+	default:
+		return fmt.Sprintf("%s %s", o.Source, o.Name)
+	}
+}
+
+// provenance keeps origins of the config fields by their paths like Section1.VarInt1.
+type provenance struct {
+	mu      sync.Mutex
+	origins map[string]Origin
+}
+
+func newProvenance() *provenance {
+	return &provenance{origins: make(map[string]Origin)}
+}
+
+func (p *provenance) set(path string, o Origin) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.origins[path] = o
+}
+
+func (p *provenance) reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.origins = make(map[string]Origin)
+}
+
+func (p *provenance) replace(other *provenance) {
+	origins := other.copy()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.origins = origins
+}
+
+func (p *provenance) copy() map[string]Origin {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	res := make(map[string]Origin, len(p.origins))
+	for k, v := range p.origins {
+		res[k] = v
+	}
+	return res
+}
+
+// Method returns origins of the config fields set by the sources, keyed by field paths like Section1.VarInt1.
+func (s Interface) Provenance() map[string]Origin {
+	return s.prov.copy()
+}
+
+// Method describes where every set config field came from, one field per line.
+func (s Interface) Explain() string {
+	origins := s.prov.copy()
+	paths := make([]string, 0, len(origins))
+	for p := range origins {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	var b strings.Builder
+	for _, p := range paths {
+		fmt.Fprintf(&b, "%s: %s\n", p, origins[p])
+	}
+	return b.String()
+}
+
+// fileOrigin returns origin finder for keys of the file content, keys are split into segments by sep if it is set.
+func fileOrigin(src Source, fileName string, data []byte, sep string) func(key string) Origin {
+	lines := bytes.Split(data, []byte("\n"))
+	return func(key string) Origin {
+		segs := []string{key}
+		if sep != "" {
+			segs = strings.Split(key, sep)
+		}
+		return Origin{Source: src, Name: fileName, Key: key, Line: findLine(lines, segs)}
+	}
+}
+
+// findLine returns the line where the key segments appear in order, 0 if they are not found.
+func findLine(lines [][]byte, segs []string) int {
+	res := make([]*regexp.Regexp, len(segs))
+	for i, seg := range segs {
+		res[i] = regexp.MustCompile(`(?i)(^|[^A-Za-z0-9_])` + regexp.QuoteMeta(seg) + `($|[^A-Za-z0-9_])`)
+	}
+	i := 0
+	for n, line := range lines {
+		for i < len(segs) {
+			loc := res[i].FindIndex(line)
+			if loc == nil {
+				break
+			}
+			line = line[loc[1]:]
+			i++
+		}
+		if i == len(segs) {
+			return n + 1
+		}
+	}
+	return 0
+}
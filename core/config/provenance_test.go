@@ -0,0 +1,97 @@
+package config
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProvenance(t *testing.T) {
+	file, err := ioutil.TempFile("", "conf.")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString(`[section1]
+varint1 = 11
+varstring1 = "first string"
+[section2]
+varint2 = 22`)
+	file.Sync()
+
+	// Для каждого поля запоминается последний источник, который его установил.
+	t.Run("Origins of fields", func(t *testing.T) {
+		require.NoError(t, os.Setenv("PROV_SECTION1_VARSTRING1", "env string"))
+		defer os.Unsetenv("PROV_SECTION1_VARSTRING1")
+		var c DefaultsConf
+		i := New(&c)
+		err := i.Combine(Config{ConfigFile: file.Name(), EnvPrefix: "PROV", Args: []string{"--section1.varbool1=false"}})
+		require.NoError(t, err)
+		require.Equal(t, map[string]Origin{
+			"Section1.VarInt1":    {Source: SourceFile, Name: file.Name(), Key: "section1.varint1", Line: 2},
+			"Section1.VarString1": {Source: SourceEnv, Name: "PROV_SECTION1_VARSTRING1"},
+			"Section1.VarBool1":   {Source: SourceFlags, Name: "--section1.varbool1"},
+		}, i.Provenance())
+		require.Equal(t, "Section1.VarBool1: flags --section1.varbool1\n"+
+			"Section1.VarInt1: file "+file.Name()+":2 (section1.varint1)\n"+
+			"Section1.VarString1: env PROV_SECTION1_VARSTRING1\n", i.Explain())
+	})
+
+	// Порядок источников задается в Config.Sources.
+	t.Run("Custom sources order", func(t *testing.T) {
+		require.NoError(t, os.Setenv("PROV_SECTION1_VARINT1", "33"))
+		defer os.Unsetenv("PROV_SECTION1_VARINT1")
+		var c TestConf
+		i := New(&c)
+		err := i.Combine(Config{ConfigFile: file.Name(), EnvPrefix: "PROV", Sources: []Source{SourceEnv, SourceFile}})
+		require.NoError(t, err)
+		require.Equal(t, 11, c.Section1.VarInt1)
+		require.Equal(t, SourceFile, i.Provenance()["Section1.VarInt1"].Source)
+
+		err = New(&c).Combine(Config{Sources: []Source{"consul"}})
+		require.Error(t, err)
+	})
+
+	// Для базы запоминается ключ строки, для значений по умолчанию - источник default.
+	t.Run("DB and default origins", func(t *testing.T) {
+		db, mock := newMock()
+		defer db.Close()
+
+		rows := sqlmock.NewRows([]string{"key", "value"})
+		rows.AddRow("section1.varint1", "22")
+
+		mock.ExpectQuery("SELECT config.key, config.value FROM config").WillReturnRows(rows)
+		var c DefaultsConf
+		i := New(&c)
+		require.NoError(t, i.SetDefaults())
+		require.NoError(t, i.SetFromDB(db, "config"))
+		require.Equal(t, Origin{Source: SourceDB, Name: "section1.varint1"}, i.Provenance()["Section1.VarInt1"])
+		require.Equal(t, Origin{Source: SourceDefault}, i.Provenance()["Section1.VarString1"])
+	})
+
+	// Значения по умолчанию невыделенного указателя не попадают в источники и события.
+	t.Run("Defaults of nil pointers", func(t *testing.T) {
+		var c PointersConf
+		var paths []string
+		i := New(&c)
+		err := i.Combine(Config{EnvPrefix: "PROVPTR", OnEvent: func(e Event) {
+			if e.Kind == EventKey {
+				paths = append(paths, e.Path)
+			}
+		}})
+		require.NoError(t, err)
+		require.Nil(t, c.TLS)
+		require.Equal(t, []string{"Retries"}, paths)
+		require.Equal(t, map[string]Origin{"Retries": {Source: SourceDefault}}, i.Provenance())
+
+		require.NoError(t, os.Setenv("PROVPTR_TLS_CERT", "cert.pem"))
+		defer os.Unsetenv("PROVPTR_TLS_CERT")
+		require.NoError(t, i.Combine(Config{EnvPrefix: "PROVPTR"}))
+		require.Equal(t, Origin{Source: SourceDefault}, i.Provenance()["TLS.Port"])
+		require.Equal(t, Origin{Source: SourceEnv, Name: "PROVPTR_TLS_CERT"}, i.Provenance()["TLS.Cert"])
+	})
+}
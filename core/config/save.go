@@ -0,0 +1,405 @@
+package config
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"database/sql"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// Method writes config fields to the config table of db, one row per dotted key like section1.varint1.
+// Rows are upserted in one transaction, t.Dialect must be postgres or mysql. Tables with t.Where filter are not supported.
+// Like in all Save methods, values of encrypt:"true" fields are saved encrypted with the key of SetKey,
+// saving fails if such field is set and there is no key.
+func (s Interface) SaveToDB(db *sql.DB, t DBTable) error {
+	q, err := t.upsert()
+	if err != nil {
+		return err
+	}
+	v := reflect.ValueOf(s.str)
+	if v.Kind() != reflect.Ptr {
+		return fmt.Errorf("not a pointer value")
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("can't begin transaction: %w", err)
+	}
+	err = pairs(reflect.Indirect(v), "", dbStyle, s.sealer(), false, func(key, val string, _ reflect.StructField) error {
+		if _, err := tx.Exec(q, key, val); err != nil {
+			return fmt.Errorf("can't save %s: %w", key, err)
+		}
+		return nil
+	})
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("can't commit transaction: %w", err)
+	}
+	return nil
+}
+
+// Method writes config to the file, format is detected by the file extension like in SetFromFile.
+func (s Interface) SaveToFile(fileName string) error {
+	return s.SaveToFileFormat(fileName, formatOf(fileName, defaultFormats()))
+}
+
+// Method writes config to the file in toml, yaml or json format.
+func (s Interface) SaveToFileFormat(fileName, format string) error {
+	v := reflect.ValueOf(s.str)
+	if v.Kind() != reflect.Ptr {
+		return fmt.Errorf("not a pointer value")
+	}
+	tree, err := toTree(reflect.Indirect(v), formatStyle(format), s.sealer(), false)
+	if err != nil {
+		return err
+	}
+	var data []byte
+	switch strings.ToLower(format) {
+	case "toml":
+		var b bytes.Buffer
+		err = toml.NewEncoder(&b).Encode(tree)
+		data = b.Bytes()
+	case "yaml", "yml":
+		data, err = yaml.Marshal(tree)
+	case "json":
+		data, err = json.MarshalIndent(tree, "", "  ")
+	default:
+		return fmt.Errorf("can't save config file in format %s", format)
+	}
+	if err != nil {
+		return fmt.Errorf("can't encode config: %w", err)
+	}
+	if err = ioutil.WriteFile(fileName, data, 0o600); err != nil {
+		return fmt.Errorf("can't write config file: %w", err)
+	}
+	return nil
+}
+
+// Method writes config as shell lines export VAR='value' with the names used by SetFromEnv.
+func (s Interface) SaveToEnv(w io.Writer, prefix string) error {
+	v := reflect.ValueOf(s.str)
+	if v.Kind() != reflect.Ptr {
+		return fmt.Errorf("not a pointer value")
+	}
+	return pairs(reflect.Indirect(v), strings.Trim(prefix, "_"), envStyle, s.sealer(), false, func(key, val string, _ reflect.StructField) error {
+		_, err := fmt.Fprintf(w, "export %s='%s'\n", key, strings.ReplaceAll(val, "'", `'\''`))
+		return err
+	})
+}
+
+// upsert builds INSERT of one key-value pair which updates the value of existing key.
+func (t DBTable) upsert() (string, error) {
+	table, key, value, err := t.names()
+	if err != nil {
+		return "", err
+	}
+	var updatedAt string
+	if t.UpdatedAtColumn != "" {
+		col, err := quoteIdent(t.Dialect, t.UpdatedAtColumn)
+		if err != nil {
+			return "", err
+		}
+		updatedAt = ", " + col + " = CURRENT_TIMESTAMP"
+	}
+	if t.Dialect == "postgres" {
+		return "INSERT INTO " + table + " (" + key + ", " + value + ") VALUES ($1, $2) ON CONFLICT (" + key + ") DO UPDATE SET " + value + " = EXCLUDED." + value + updatedAt, nil
+	}
+	return "INSERT INTO " + table + " (" + key + ", " + value + ") VALUES (?, ?) ON DUPLICATE KEY UPDATE " + value + " = VALUES(" + value + ")" + updatedAt, nil
+}
+
+// names returns quoted schema qualified table name and key and value columns for writing queries.
+func (t DBTable) names() (table, key, value string, err error) {
+	t = t.withDefaults()
+	if t.Dialect != "postgres" && t.Dialect != "mysql" {
+		return "", "", "", fmt.Errorf("can't write config with SQL dialect %q", t.Dialect)
+	}
+	if t.Where != "" {
+		// Rows of other services would be overwritten, since the key is the only primary key column.
+		return "", "", "", fmt.Errorf("can't write config table with filter %q", t.Where)
+	}
+	if table, err = quoteIdent(t.Dialect, t.Name); err != nil {
+		return "", "", "", err
+	}
+	if t.Schema != "" {
+		schema, err := quoteIdent(t.Dialect, t.Schema)
+		if err != nil {
+			return "", "", "", err
+		}
+		table = schema + "." + table
+	}
+	if key, err = quoteIdent(t.Dialect, t.KeyColumn); err != nil {
+		return "", "", "", err
+	}
+	if value, err = quoteIdent(t.Dialect, t.ValueColumn); err != nil {
+		return "", "", "", err
+	}
+	return table, key, value, nil
+}
+
+// sealer encrypts values of encrypt:"true" fields on save, so decrypted secrets are not written back as plain text.
+type sealer struct {
+	aead cipher.AEAD
+}
+
+func (s Interface) sealer() sealer {
+	return sealer{aead: s.keys.get()}
+}
+
+// seal returns the value of the encrypted field to save, it fails if there is no key to encrypt the value.
+func (sl sealer) seal(key, val string) (string, error) {
+	if sl.aead == nil {
+		return "", fmt.Errorf("can't save encrypted field %s, encryption key is not set", key)
+	}
+	return encrypt(sl.aead, val)
+}
+
+// isEncrypted reports whether the field has encrypt:"true" tag, secret:"true" only masks the field in dumps.
+func isEncrypted(f reflect.StructField) bool {
+	encrypted, _ := strconv.ParseBool(f.Tag.Get("encrypt"))
+	return encrypted
+}
+
+// pairs calls fn for every set scalar field with its key and value formatted like sources expect it.
+// Non-zero values of encrypted fields and of all fields of encrypted sections are sealed.
+func pairs(v reflect.Value, prefix string, ks keyStyle, sl sealer, encrypt bool, fn func(key, val string, f reflect.StructField) error) error {
+	if !isSection(v) {
+		return fmt.Errorf("not a struct value")
+	}
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		name, ok := ks.fieldKey(f)
+		if !ok {
+			continue
+		}
+		if err := fieldPairs(v.Field(i), f, ks.join(prefix, name), ks, sl, encrypt || isEncrypted(f), fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func fieldPairs(v reflect.Value, f reflect.StructField, key string, ks keyStyle, sl sealer, encrypt bool, fn func(key, val string, f reflect.StructField) error) error {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	switch {
+	case isSection(v):
+		return pairs(v, key, ks, sl, encrypt, fn)
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Struct && isSection(reflect.New(v.Type().Elem()).Elem()):
+		for i := 0; i < v.Len(); i++ {
+			if err := pairs(v.Index(i), ks.join(key, strconv.Itoa(i)), ks, sl, encrypt, fn); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	val, err := formatValue(v, f.Tag.Get("sep"))
+	if err != nil {
+		return fmt.Errorf("can't format %s: %w", key, err)
+	}
+	if encrypt && !v.IsZero() {
+		if val, err = sl.seal(key, val); err != nil {
+			return err
+		}
+	}
+	return fn(key, val, f)
+}
+
+// formatValue converts the value into the string which selector and setValue parse back.
+func formatValue(v reflect.Value, sep string) (string, error) {
+	if v.Type() == durationType {
+		return v.Interface().(fmt.Stringer).String(), nil
+	}
+	if v.Type().Implements(textMarshalerType) || reflect.PtrTo(v.Type()).Implements(textMarshalerType) {
+		m, ok := v.Interface().(encoding.TextMarshaler)
+		if !ok {
+			p := reflect.New(v.Type())
+			p.Elem().Set(v)
+			m = p.Interface().(encoding.TextMarshaler)
+		}
+		text, err := m.MarshalText()
+		return string(text), err
+	}
+	if sep == "" {
+		sep = ","
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits()), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Slice, reflect.Array:
+		parts := make([]string, v.Len())
+		for i := range parts {
+			p, err := formatValue(v.Index(i), "")
+			if err != nil {
+				return "", err
+			}
+			parts[i] = p
+		}
+		return strings.Join(parts, sep), nil
+	case reflect.Map:
+		parts := make([]string, 0, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			k, err := formatValue(iter.Key(), "")
+			if err != nil {
+				return "", err
+			}
+			e, err := formatValue(iter.Value(), "")
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, k+"="+e)
+		}
+		sort.Strings(parts)
+		return strings.Join(parts, sep), nil
+	}
+	if st, ok := v.Interface().(fmt.Stringer); ok {
+		return st.String(), nil
+	}
+	return "", fmt.Errorf("unsupported type %s", v.Type())
+}
+
+// toTree converts the config struct into nested maps with the keys used by SetFromFile for the key style of the format.
+// Non-zero values of encrypted fields are sealed and saved as strings.
+func toTree(v reflect.Value, ks keyStyle, sl sealer, encrypt bool) (map[string]interface{}, error) {
+	if !isSection(v) {
+		return nil, fmt.Errorf("not a struct value")
+	}
+	res := make(map[string]interface{})
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		name, ok := ks.fieldKey(f)
+		if !ok {
+			continue
+		}
+		fv, fencrypt := v.Field(i), encrypt || isEncrypted(f)
+		if ks.promoted(f) {
+			if fv.Kind() == reflect.Ptr && fv.IsNil() {
+				continue
+			}
+			sub, err := toTree(reflect.Indirect(fv), ks, sl, fencrypt)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", f.Name, err)
+			}
+			for k, val := range sub {
+				if _, ok := res[k]; !ok {
+					res[k] = val
+				}
+			}
+			continue
+		}
+		if fencrypt && !isSection(reflect.Indirect(fv)) && !reflect.Indirect(fv).IsZero() {
+			val, err := formatValue(reflect.Indirect(fv), f.Tag.Get("sep"))
+			if err != nil {
+				return nil, fmt.Errorf("can't encode %s: %w", f.Name, err)
+			}
+			if res[name], err = sl.seal(f.Name, val); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		val, ok, err := treeValue(fv, ks, sl, fencrypt)
+		if err != nil {
+			return nil, fmt.Errorf("can't encode %s: %w", f.Name, err)
+		}
+		if ok {
+			res[name] = val
+		}
+	}
+	return res, nil
+}
+
+// treeValue returns the value for file encoders and false for nil pointers.
+func treeValue(v reflect.Value, ks keyStyle, sl sealer, encrypt bool) (interface{}, bool, error) {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil, false, nil
+		}
+		v = v.Elem()
+	}
+	switch {
+	case isSection(v):
+		m, err := toTree(v, ks, sl, encrypt)
+		return m, true, err
+	case v.Type() == timeType:
+		return v.Interface(), true, nil
+	case v.Type() == durationType || v.Type().Implements(textMarshalerType) || reflect.PtrTo(v.Type()).Implements(textMarshalerType):
+		s, err := formatValue(v, "")
+		return s, true, err
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), true, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint(), true, nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true, nil
+	case reflect.Bool:
+		return v.Bool(), true, nil
+	case reflect.String:
+		return v.String(), true, nil
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil, false, nil
+		}
+		res := make([]interface{}, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			e, ok, err := treeValue(v.Index(i), ks, sl, encrypt)
+			if err != nil {
+				return nil, false, err
+			}
+			if ok {
+				res = append(res, e)
+			}
+		}
+		return res, true, nil
+	case reflect.Map:
+		if v.IsNil() {
+			return nil, false, nil
+		}
+		res := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			e, ok, err := treeValue(iter.Value(), ks, sl, encrypt)
+			if err != nil {
+				return nil, false, err
+			}
+			if ok {
+				res[fmt.Sprint(iter.Key().Interface())] = e
+			}
+		}
+		return res, true, nil
+	}
+	s, err := formatValue(v, "")
+	return s, true, err
+}
@@ -0,0 +1,251 @@
+package config
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+)
+
+type SaveConf struct {
+	Section1 struct {
+		VarInt1    int
+		VarString1 string `config:"name"`
+		VarBool1   bool
+	}
+	Hosts   []string `sep:";"`
+	Labels  map[string]string
+	Timeout time.Duration
+	TLS     *struct {
+		Cert string
+	}
+}
+
+func newSaveConf() SaveConf {
+	var c SaveConf
+	c.Section1.VarInt1 = 11
+	c.Section1.VarString1 = "it's a string"
+	c.Section1.VarBool1 = true
+	c.Hosts = []string{"a", "b"}
+	c.Labels = map[string]string{"env": "prod", "team": "core"}
+	c.Timeout = 5 * time.Second
+	return c
+}
+
+func TestSaveToFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "conf")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Сохраненный в любом формате файл читается обратно в тот же конфиг.
+	for _, name := range []string{"conf.toml", "conf.yaml", "conf.json"} {
+		name := name
+		t.Run("Round trip "+name, func(t *testing.T) {
+			c := newSaveConf()
+			file := filepath.Join(dir, name)
+			require.NoError(t, New(&c).SaveToFile(file))
+			var loaded SaveConf
+			require.NoError(t, New(&loaded).SetFromFile(file))
+			require.Equal(t, c, loaded)
+		})
+	}
+
+	// Поля встроенной структуры сохраняются на уровне родителя.
+	t.Run("Embedded structs", func(t *testing.T) {
+		c := EmbConf{Base: Base{Host: "h"}, Port: 8080}
+		file := filepath.Join(dir, "emb.toml")
+		require.NoError(t, New(&c).SaveToFile(file))
+		data, err := ioutil.ReadFile(file)
+		require.NoError(t, err)
+		require.NotContains(t, string(data), "[base]")
+		var loaded EmbConf
+		require.NoError(t, New(&loaded).SetFromFile(file))
+		require.Equal(t, c, loaded)
+	})
+}
+
+func TestSaveToEnv(t *testing.T) {
+
+	// Переменные записываются с именами SetFromEnv и читаются обратно из .env файла.
+	t.Run("Export lines", func(t *testing.T) {
+		c := newSaveConf()
+		var b bytes.Buffer
+		require.NoError(t, New(&c).SaveToEnv(&b, "APP"))
+		require.Equal(t, `export APP_SECTION1_VARINT1='11'
+export APP_SECTION1_name='it'\''s a string'
+export APP_SECTION1_VARBOOL1='true'
+export APP_HOSTS='a;b'
+export APP_LABELS='env=prod,team=core'
+export APP_TIMEOUT='5s'
+`, b.String())
+	})
+
+	// Записанный файл читается через SetFromDotEnv в тот же конфиг.
+	t.Run("Round trip", func(t *testing.T) {
+		c := newSaveConf()
+		file, err := ioutil.TempFile("", "conf*.env")
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer os.Remove(file.Name())
+		require.NoError(t, New(&c).SaveToEnv(file, "SAVE"))
+		require.NoError(t, file.Close())
+		var loaded SaveConf
+		require.NoError(t, New(&loaded).SetFromDotEnv(file.Name(), "SAVE"))
+		require.Equal(t, c, loaded)
+	})
+}
+
+func TestSaveToDB(t *testing.T) {
+
+	// Все ключи записываются в одной транзакции через upsert.
+	t.Run("Upsert in transaction", func(t *testing.T) {
+		db, mock := newMock()
+		defer db.Close()
+
+		q := regexp.QuoteMeta(`INSERT INTO "config" ("key", "value") VALUES ($1, $2) ON CONFLICT ("key") DO UPDATE SET "value" = EXCLUDED."value"`)
+		mock.ExpectBegin()
+		for _, kv := range [][2]string{
+			{"section1.varint1", "11"}, {"section1.name", "it's a string"}, {"section1.varbool1", "true"},
+			{"hosts", "a;b"}, {"labels", "env=prod,team=core"}, {"timeout", "5s"},
+		} {
+			mock.ExpectExec(q).WithArgs(kv[0], kv[1]).WillReturnResult(sqlmock.NewResult(0, 1))
+		}
+		mock.ExpectCommit()
+		c := newSaveConf()
+		require.NoError(t, New(&c).SaveToDB(db, DBTable{Dialect: "postgres"}))
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	// Для MySQL используется ON DUPLICATE KEY UPDATE, при ошибке транзакция откатывается.
+	t.Run("Rollback on error", func(t *testing.T) {
+		db, mock := newMock()
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `config` (`key`, `value`) VALUES (?, ?) ON DUPLICATE KEY UPDATE `value` = VALUES(`value`)")).
+			WillReturnError(os.ErrPermission)
+		mock.ExpectRollback()
+		c := newSaveConf()
+		require.Error(t, New(&c).SaveToDB(db, DBTable{Dialect: "mysql"}))
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	// Если задана колонка времени изменения, upsert обновляет и ее, иначе Postgres не заметит изменения в max(updated_at).
+	t.Run("Updated at column", func(t *testing.T) {
+		q, err := DBTable{Dialect: "postgres", UpdatedAtColumn: "updated_at"}.upsert()
+		require.NoError(t, err)
+		require.Equal(t, `INSERT INTO "config" ("key", "value") VALUES ($1, $2) ON CONFLICT ("key") DO UPDATE SET "value" = EXCLUDED."value", "updated_at" = CURRENT_TIMESTAMP`, q)
+		q, err = DBTable{Dialect: "mysql", UpdatedAtColumn: "updated_at"}.upsert()
+		require.NoError(t, err)
+		require.Equal(t, "INSERT INTO `config` (`key`, `value`) VALUES (?, ?) ON DUPLICATE KEY UPDATE `value` = VALUES(`value`), `updated_at` = CURRENT_TIMESTAMP", q)
+	})
+
+	// Без диалекта сохранение невозможно.
+	t.Run("No dialect", func(t *testing.T) {
+		db, _ := newMock()
+		defer db.Close()
+		c := newSaveConf()
+		require.Error(t, New(&c).SaveToDB(db, DBTable{}))
+	})
+
+	// Запись в таблицу с фильтром невозможна, ключ без колонок фильтра перезаписал бы строки других сервисов.
+	t.Run("Filtered table", func(t *testing.T) {
+		db, mock := newMock()
+		defer db.Close()
+		c := newSaveConf()
+		table := DBTable{Dialect: "postgres", Where: "app = ?", Args: []interface{}{"billing"}}
+		require.Error(t, New(&c).SaveToDB(db, table))
+		require.Error(t, New(&c).SeedDB(db, table, "admin"))
+		require.Error(t, CreateTable(db, table))
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+type SecretSaveConf struct {
+	DB struct {
+		User     string
+		Password string `secret:"true" encrypt:"true"`
+	}
+	TLS struct {
+		Key string
+	} `encrypt:"true"`
+}
+
+func TestSaveSecrets(t *testing.T) {
+	key, err := NewKey()
+	require.NoError(t, err)
+	var c SecretSaveConf
+	c.DB.User = "app"
+	c.DB.Password = "hunter2"
+	c.TLS.Key = "tls-key"
+
+	// Секретные поля сохраняются зашифрованными и читаются обратно тем же ключом.
+	t.Run("Encrypted on save", func(t *testing.T) {
+		i := New(&c)
+		require.NoError(t, i.SetKey(key))
+		var b bytes.Buffer
+		require.NoError(t, i.SaveToEnv(&b, "SS"))
+		require.Contains(t, b.String(), "export SS_DB_USER='app'\n")
+		require.Contains(t, b.String(), "export SS_DB_PASSWORD='enc:")
+		require.Contains(t, b.String(), "export SS_TLS_KEY='enc:")
+		require.NotContains(t, b.String(), "hunter2")
+		require.NotContains(t, b.String(), "tls-key")
+
+		dir, err := ioutil.TempDir("", "conf")
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		for _, name := range []string{"conf.env", "conf.toml", "conf.yaml"} {
+			file := filepath.Join(dir, name)
+			if name == "conf.env" {
+				require.NoError(t, ioutil.WriteFile(file, b.Bytes(), 0o600))
+			} else {
+				require.NoError(t, i.SaveToFile(file))
+				data, err := ioutil.ReadFile(file)
+				require.NoError(t, err)
+				require.NotContains(t, string(data), "hunter2")
+			}
+			var loaded SecretSaveConf
+			l := New(&loaded)
+			require.NoError(t, l.SetKey(key))
+			if name == "conf.env" {
+				require.NoError(t, l.SetFromDotEnv(file, "SS"))
+			} else {
+				require.NoError(t, l.SetFromFile(file))
+			}
+			require.Equal(t, c, loaded, name)
+		}
+	})
+
+	// Без ключа шифруемые поля не сохраняются в открытом виде, а пустые сохраняются как есть.
+	// Тег secret только скрывает значение в дампах и не требует ключа.
+	t.Run("No key", func(t *testing.T) {
+		var b bytes.Buffer
+		require.Error(t, New(&c).SaveToEnv(&b, "SS"))
+		require.NotContains(t, b.String(), "hunter2")
+		require.Error(t, New(&c).SaveToFile(filepath.Join(os.TempDir(), "secret-conf.toml")))
+
+		var empty SecretSaveConf
+		empty.DB.User = "app"
+		b.Reset()
+		require.NoError(t, New(&empty).SaveToEnv(&b, "SS"))
+		require.Contains(t, b.String(), "export SS_DB_PASSWORD=''\n")
+
+		var r RedactConf
+		r.Token = "t0ken"
+		b.Reset()
+		require.NoError(t, New(&r).SaveToEnv(&b, "RS"))
+		require.Contains(t, b.String(), "export RS_TOKEN='t0ken'\n")
+	})
+}
@@ -0,0 +1,90 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	// secretPrefix marks the value which is a path of the file with the actual value, like Docker and Kubernetes secrets.
+	// It is resolved only for fields with fromfile:"true" tag, other fields keep file:// URLs as is.
+	secretPrefix = "file://"
+	// fileSuffix marks the env variable holding the path of the file with the value, like APP_DB_PASSWORD_FILE.
+	fileSuffix = "_FILE"
+)
+
+// fileRef is the path of the file with the value taken from KEY_FILE variable, it is read for any field.
+type fileRef string
+
+// fromFile reports whether the field has fromfile:"true" tag.
+func fromFile(tag reflect.StructTag) bool {
+	ok, _ := strconv.ParseBool(tag.Get("fromfile"))
+	return ok
+}
+
+// readSecret replaces the file reference with the trimmed content of the file.
+// Strings with file:// prefix are references only if tagged is set.
+func readSecret(val interface{}, tagged bool) (interface{}, error) {
+	var path string
+	switch v := val.(type) {
+	case fileRef:
+		path = strings.TrimPrefix(string(v), secretPrefix)
+	case string:
+		if !tagged || !strings.HasPrefix(v, secretPrefix) {
+			return val, nil
+		}
+		path = strings.TrimPrefix(v, secretPrefix)
+	default:
+		return val, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("can't read secret file: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// resolve reads file reference and decrypts enc: value with the key of the decoder.
+func (d decoder) resolve(val interface{}, tag reflect.StructTag) (interface{}, error) {
+	val, err := readSecret(val, fromFile(tag))
+	if err != nil {
+		return nil, err
+	}
+	str, ok := val.(string)
+	if !ok || !strings.HasPrefix(str, encPrefix) {
+		return val, nil
+	}
+	if d.aead == nil {
+		return nil, fmt.Errorf("can't decrypt value, encryption key is not set")
+	}
+	return decrypt(d.aead, str)
+}
+
+// withFileSuffix makes the source look up KEY_FILE variable with the file path if KEY is not set.
+func withFileSuffix(src source) source {
+	lookup := src.lookup
+	src.lookup = func(key string) (interface{}, bool) {
+		if val, ok := lookup(key); ok {
+			return val, true
+		}
+		val, _ := lookup(key + fileSuffix)
+		path, ok := val.(string)
+		if !ok || path == "" {
+			return nil, false
+		}
+		return fileRef(path), true
+	}
+	origin := src.origin
+	if origin != nil {
+		src.origin = func(key string) Origin {
+			if _, ok := lookup(key); ok {
+				return origin(key)
+			}
+			return origin(key + fileSuffix)
+		}
+	}
+	return src
+}
@@ -0,0 +1,87 @@
+package config
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+)
+
+type SecretConf struct {
+	Password string `fromfile:"true"`
+	Storage  string
+}
+
+func TestSecretFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secrets")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	secret := filepath.Join(dir, "db_password")
+	if err = ioutil.WriteFile(secret, []byte("s3cr3t\n"), 0o600); err != nil {
+		log.Fatal(err)
+	}
+
+	// Значение file:// поля с тегом fromfile заменяется содержимым файла без пробелов и переводов строк по краям.
+	t.Run("Env reference", func(t *testing.T) {
+		require.NoError(t, os.Setenv("SEC_PASSWORD", "file://"+secret))
+		defer os.Unsetenv("SEC_PASSWORD")
+		require.NoError(t, os.Setenv("SEC_STORAGE", "file:///tmp"))
+		defer os.Unsetenv("SEC_STORAGE")
+		var c SecretConf
+		require.NoError(t, New(&c).SetFromEnv("SEC"))
+		require.Equal(t, "s3cr3t", c.Password)
+		require.Equal(t, "file:///tmp", c.Storage)
+	})
+
+	// Переменная с суффиксом _FILE содержит путь к файлу, но сама переменная имеет приоритет.
+	t.Run("Env _FILE suffix", func(t *testing.T) {
+		require.NoError(t, os.Setenv("SECF_SECTION1_VARSTRING1_FILE", secret))
+		defer os.Unsetenv("SECF_SECTION1_VARSTRING1_FILE")
+		require.NoError(t, os.Setenv("SECF_SECTION2_VARSTRING2_FILE", secret))
+		defer os.Unsetenv("SECF_SECTION2_VARSTRING2_FILE")
+		require.NoError(t, os.Setenv("SECF_SECTION2_VARSTRING2", "plain"))
+		defer os.Unsetenv("SECF_SECTION2_VARSTRING2")
+		var c TestConf
+		i := New(&c)
+		require.NoError(t, i.Combine(Config{EnvPrefix: "SECF"}))
+		require.Equal(t, "s3cr3t", c.Section1.VarString1)
+		require.Equal(t, "plain", c.Section2.VarString2)
+		require.Equal(t, "SECF_SECTION1_VARSTRING1_FILE", i.Provenance()["Section1.VarString1"].Name)
+	})
+
+	// Ссылки работают в файле конфига и в таблице базы, поля без тега сохраняют URL как есть.
+	t.Run("File and DB references", func(t *testing.T) {
+		file := filepath.Join(dir, "conf.toml")
+		require.NoError(t, ioutil.WriteFile(file, []byte("password = \"file://"+secret+"\"\nstorage = \"file://"+secret+"\"\n"), 0o600))
+		var c SecretConf
+		require.NoError(t, New(&c).SetFromFile(file))
+		require.Equal(t, "s3cr3t", c.Password)
+		require.Equal(t, "file://"+secret, c.Storage)
+
+		db, mock := newMock()
+		defer db.Close()
+		rows := sqlmock.NewRows([]string{"key", "value"})
+		rows.AddRow("password", "file://"+secret)
+		rows.AddRow("storage", "file:///tmp")
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT config.key, config.value FROM config")).WillReturnRows(rows)
+		c = SecretConf{}
+		require.NoError(t, New(&c).SetFromDB(db, ""))
+		require.Equal(t, "s3cr3t", c.Password)
+		require.Equal(t, "file:///tmp", c.Storage)
+	})
+
+	// Отсутствующий файл секрета - ошибка, а не пустое значение.
+	t.Run("Missing file", func(t *testing.T) {
+		require.NoError(t, os.Setenv("SECM_PASSWORD", "file://"+filepath.Join(dir, "missing")))
+		defer os.Unsetenv("SECM_PASSWORD")
+		var c SecretConf
+		require.Error(t, New(&c).SetFromEnv("SECM"))
+	})
+}
@@ -0,0 +1,145 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ValidationError lists every missing or invalid config field.
+type ValidationError []string
+
+func (e ValidationError) Error() string {
+	return "invalid config: " + strings.Join(e, "; ")
+}
+
+// Method checks required and validate tags of the config fields.
+// Tag validate holds comma separated rules: min=N, max=N, oneof=a b c and regex=EXPR.
+// Rule regex must be the last one, the rest of the tag is used as expression.
+// Rules are checked for zero values too, so min=1 catches the field left unset.
+func (s Interface) Validate() error {
+	v := reflect.ValueOf(s.str)
+	if v.Kind() != reflect.Ptr {
+		return fmt.Errorf("not a pointer value")
+	}
+	var errs ValidationError
+	if reflect.Indirect(v).Kind() == reflect.Struct {
+		validateStruct(reflect.Indirect(v), "", &errs)
+	}
+	if len(errs) != 0 {
+		return errs
+	}
+	return nil
+}
+
+func validateStruct(v reflect.Value, prefix string, errs *ValidationError) {
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		if f.PkgPath != "" && !f.Anonymous {
+			continue
+		}
+		path := joinPath(prefix, f.Name)
+		fv := v.Field(i)
+		if req, _ := strconv.ParseBool(f.Tag.Get("required")); req && fv.IsZero() {
+			*errs = append(*errs, path+": required")
+			continue
+		}
+		fv = reflect.Indirect(fv)
+		if !fv.IsValid() {
+			continue
+		}
+		if rules, ok := f.Tag.Lookup("validate"); ok {
+			for _, msg := range validateRules(fv, rules) {
+				*errs = append(*errs, path+": "+msg)
+			}
+		}
+		if isSection(fv) {
+			validateStruct(fv, path, errs)
+		}
+	}
+}
+
+func validateRules(v reflect.Value, rules string) []string {
+	var res []string
+	for rules != "" {
+		var rule string
+		if strings.HasPrefix(rules, "regex=") {
+			rule, rules = rules, ""
+		} else {
+			i := strings.Index(rules, ",")
+			if i < 0 {
+				i = len(rules)
+			}
+			rule, rules = rules[:i], strings.TrimPrefix(rules[i:], ",")
+		}
+		kv := strings.SplitN(rule, "=", 2)
+		if len(kv) != 2 {
+			res = append(res, fmt.Sprintf("bad rule %q", rule))
+			continue
+		}
+		if msg := checkRule(v, kv[0], kv[1]); msg != "" {
+			res = append(res, msg)
+		}
+	}
+	return res
+}
+
+func checkRule(v reflect.Value, name, arg string) string {
+	switch name {
+	case "min", "max":
+		limit, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return fmt.Sprintf("bad %s argument %q", name, arg)
+		}
+		val, ok := measure(v)
+		if !ok {
+			return fmt.Sprintf("rule %s can't be used with %s", name, v.Type())
+		}
+		if name == "min" && val < limit {
+			return fmt.Sprintf("must be >= %s", arg)
+		}
+		if name == "max" && val > limit {
+			return fmt.Sprintf("must be <= %s", arg)
+		}
+	case "oneof":
+		val := fmt.Sprint(v.Interface())
+		for _, opt := range strings.Fields(arg) {
+			if val == opt {
+				return ""
+			}
+		}
+		return fmt.Sprintf("must be one of [%s]", arg)
+	case "regex":
+		if v.Kind() != reflect.String {
+			return fmt.Sprintf("rule regex can't be used with %s", v.Type())
+		}
+		re, err := regexp.Compile(arg)
+		if err != nil {
+			return fmt.Sprintf("bad regex %q", arg)
+		}
+		if !re.MatchString(v.String()) {
+			return fmt.Sprintf("must match %s", arg)
+		}
+	default:
+		return fmt.Sprintf("unknown rule %q", name)
+	}
+	return ""
+}
+
+// measure returns a number for numeric values or a length for strings and collections.
+func measure(v reflect.Value) (float64, bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return float64(v.Len()), true
+	default:
+		return 0, false
+	}
+}
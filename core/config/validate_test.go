@@ -0,0 +1,67 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type ValidateConf struct {
+	Section1 struct {
+		VarInt1    int    `required:"true" validate:"min=1,max=100"`
+		VarString1 string `validate:"oneof=debug info warn"`
+		VarString2 string `validate:"regex=^([a-z]+,[0-9]+)?$"`
+		Port       int    `validate:"min=1,max=65535"`
+	}
+}
+
+func TestValidate(t *testing.T) {
+
+	// Если все поля корректны, метод вернет nil.
+	t.Run("Valid config", func(t *testing.T) {
+		var c ValidateConf
+		c.Section1.VarInt1 = 11
+		c.Section1.VarString1 = "info"
+		c.Section1.VarString2 = "abc,123"
+		c.Section1.Port = 8080
+		require.NoError(t, New(&c).Validate())
+	})
+
+	// Если поля некорректны, метод вернет одну ошибку со списком всех полей.
+	t.Run("All errors in one", func(t *testing.T) {
+		var c ValidateConf
+		c.Section1.VarString1 = "trace"
+		c.Section1.VarString2 = "abc"
+		err := New(&c).Validate()
+		require.Error(t, err)
+		var verr ValidationError
+		require.True(t, errors.As(err, &verr))
+		require.Equal(t, ValidationError{
+			"Section1.VarInt1: required",
+			"Section1.VarString1: must be one of [debug info warn]",
+			"Section1.VarString2: must match ^([a-z]+,[0-9]+)?$",
+			"Section1.Port: must be >= 1",
+		}, verr)
+	})
+
+	// Если число вне границ, метод вернет ошибку.
+	t.Run("Out of range", func(t *testing.T) {
+		var c ValidateConf
+		c.Section1.VarInt1 = 101
+		c.Section1.VarString1 = "debug"
+		c.Section1.Port = 65536
+		err := New(&c).Validate()
+		require.EqualError(t, err, "invalid config: Section1.VarInt1: must be <= 100; Section1.Port: must be <= 65535")
+	})
+
+	// Combine проверяет конфиг после применения всех источников.
+	t.Run("Validation in Combine", func(t *testing.T) {
+		require.NoError(t, os.Setenv("VAL_SECTION1_VARINT1", "0"))
+		defer os.Unsetenv("VAL_SECTION1_VARINT1")
+		var c ValidateConf
+		err := New(&c).Combine(Config{EnvPrefix: "VAL"})
+		require.EqualError(t, err, "invalid config: Section1.VarInt1: required; Section1.VarString1: must be one of [debug info warn]; Section1.Port: must be >= 1")
+	})
+}
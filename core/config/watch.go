@@ -0,0 +1,303 @@
+package config
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// DefaultWatchInterval is used by Watch if Config.WatchInterval is not set.
+const DefaultWatchInterval = time.Second
+
+// ChangeFunc is called after reload with deep copies of the old and updated config and paths of the changed fields.
+type ChangeFunc func(old, updated interface{}, changed []string)
+
+// watchState guards the config struct during reloads and keeps change callbacks.
+type watchState struct {
+	mu        sync.RWMutex
+	callbacks []ChangeFunc
+	base      reflect.Value // copy of the struct before the first Combine, reloads start from it
+}
+
+// keepBase saves a copy of the struct if it is not saved yet, so values set by the caller survive reloads.
+func (w *watchState) keepBase(v reflect.Value) {
+	if w == nil || v.Kind() != reflect.Ptr || v.IsNil() {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.base.IsValid() {
+		w.base = deepCopy(v)
+	}
+}
+
+func (w *watchState) baseCopy() reflect.Value {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return deepCopy(w.base)
+}
+
+// Method registers callback called by Watch when reload changes any field.
+func (s Interface) OnChange(f ChangeFunc) {
+	s.watch.mu.Lock()
+	defer s.watch.mu.Unlock()
+	s.watch.callbacks = append(s.watch.callbacks, f)
+}
+
+// Method reloads config from the sources of c when the config file changes or SIGHUP is received,
+// until ctx is done. The struct is replaced as a whole only if all sources and validation succeed.
+// Failed reloads keep the current config and are sent to the returned channel if it has free space.
+// The struct itself is overwritten in place, so reading it concurrently with Watch is a data race:
+// read config with Holder().Load() instead, snapshots of the holder are replaced atomically.
+func (s Interface) Watch(ctx context.Context, c Config) <-chan error {
+	errs := make(chan error, 1)
+	interval := c.WatchInterval
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	stamp := fileStamp(c.ConfigFile)
+	go func() {
+		defer close(errs)
+		defer signal.Stop(hup)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+			case <-ticker.C:
+				st := fileStamp(c.ConfigFile)
+				if st == stamp {
+					continue
+				}
+				stamp = st
+			}
+			if err := s.ReloadContext(ctx, c); err != nil {
+				select {
+				case errs <- err:
+				default:
+				}
+			}
+		}
+	}()
+	return errs
+}
+
+// Method polls the config table every c.WatchInterval until ctx is done and reloads config from
+// the sources of c when the table changes. The pool c.DB is reused for all polls and reloads,
+// if it is not set, the pool is dialed once from c.DSN and closed when ctx is done.
+// Failed polls and reloads are sent to the returned channel if it has free space.
+// Like with Watch, read config with Holder().Load() while WatchDB is running.
+func (s Interface) WatchDB(ctx context.Context, c Config) <-chan error {
+	errs := make(chan error, 1)
+	if c.DB == nil {
+		dctx, cancel := withTimeout(ctx, c.DBConnectTimeout)
+		db, _, err := DialDSNContext(dctx, c.DSN)
+		cancel()
+		if err != nil {
+			errs <- fmt.Errorf("can't dial DB: %w", err)
+			close(errs)
+			return errs
+		}
+		c.DB = db
+		if c.DBTable.Dialect == "" {
+			c.DBTable.Dialect = dialectOf(c.DSN)
+		}
+		go func() {
+			<-ctx.Done()
+			db.Close()
+		}()
+	}
+	interval := c.WatchInterval
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+	state, err := dbState(ctx, c)
+	if err != nil {
+		errs <- err
+	}
+	go func() {
+		defer close(errs)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			st, err := dbState(ctx, c)
+			if err == nil && st != state {
+				if err = s.ReloadContext(ctx, c); err == nil {
+					state = st
+				}
+			}
+			if err != nil {
+				select {
+				case errs <- err:
+				default:
+				}
+			}
+		}
+	}()
+	return errs
+}
+
+// dbState returns the value of c.DBVersionQuery or the whole config table content if it is not set.
+func dbState(ctx context.Context, c Config) (string, error) {
+	ctx, cancel := withTimeout(ctx, c.DBQueryTimeout)
+	defer cancel()
+	if c.DBVersionQuery != "" {
+		var v sql.NullString
+		if err := c.DB.QueryRowContext(ctx, c.DBVersionQuery).Scan(&v); err != nil {
+			return "", fmt.Errorf("can't get config version from DB: %w", err)
+		}
+		return v.String, nil
+	}
+	kv, err := readDB(ctx, c.DB, c.DBTable)
+	if err != nil {
+		return "", err
+	}
+	keys := make([]string, 0, len(kv))
+	for k := range kv {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		fmt.Fprintf(&b, "%q=%q\n", k, kv[k])
+	}
+	return b.String(), nil
+}
+
+// Method applies all sources of c to a copy of the config as it was before the first Combine,
+// so values set by the caller before Combine are kept. The result is copied into the struct on success,
+// then OnChange callbacks are called if any field changed.
+func (s Interface) Reload(c Config) error {
+	return s.ReloadContext(context.Background(), c)
+}
+
+// Method is Reload which stops applying sources when ctx is done, the config is not changed then.
+func (s Interface) ReloadContext(ctx context.Context, c Config) error {
+	v := reflect.ValueOf(s.str)
+	if v.Kind() != reflect.Ptr {
+		return fmt.Errorf("not a pointer value")
+	}
+	s.watch.keepBase(v)
+	tmp := s
+	tmp.str = s.watch.baseCopy().Interface()
+	tmp.prov = newProvenance()
+	tmp.holder = nil
+	if err := tmp.CombineContext(ctx, c); err != nil {
+		return fmt.Errorf("can't reload config: %w", err)
+	}
+
+	s.watch.mu.Lock()
+	old := reflect.New(v.Elem().Type())
+	old.Elem().Set(v.Elem())
+	v.Elem().Set(reflect.ValueOf(tmp.str).Elem())
+	s.prov.replace(tmp.prov)
+	if s.holder != nil {
+		if err := s.holder.Store(s.str); err != nil {
+			s.watch.mu.Unlock()
+			return err
+		}
+	}
+	callbacks := append([]ChangeFunc(nil), s.watch.callbacks...)
+	s.watch.mu.Unlock()
+
+	var changed []string
+	diffPaths(old.Elem(), reflect.ValueOf(tmp.str).Elem(), "", &changed)
+	if len(changed) == 0 {
+		return nil
+	}
+	for _, f := range callbacks {
+		f(deepCopy(old).Interface(), deepCopy(reflect.ValueOf(tmp.str)).Interface(), changed)
+	}
+	return nil
+}
+
+// fileStamp returns modification time and size of the file to detect its changes.
+func fileStamp(fileName string) string {
+	if fileName == "" {
+		return ""
+	}
+	fi, err := os.Stat(fileName)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%d/%d", fi.ModTime().UnixNano(), fi.Size())
+}
+
+// diffPaths collects paths of the fields which differ in the two values of the same type.
+func diffPaths(a, b reflect.Value, path string, res *[]string) {
+	switch {
+	case a.Kind() == reflect.Ptr && !a.IsNil() && !b.IsNil():
+		diffPaths(a.Elem(), b.Elem(), path, res)
+	case isSection(a):
+		for i := 0; i < a.NumField(); i++ {
+			if f := a.Type().Field(i); f.PkgPath == "" || f.Anonymous {
+				diffPaths(a.Field(i), b.Field(i), joinPath(path, f.Name), res)
+			}
+		}
+	case !reflect.DeepEqual(a.Interface(), b.Interface()):
+		*res = append(*res, path)
+	}
+}
+
+// deepCopy returns a copy of the value which shares no pointers, slices and maps with it.
+func deepCopy(v reflect.Value) reflect.Value {
+	res := reflect.New(v.Type()).Elem()
+	copyValue(res, v)
+	return res
+}
+
+func copyValue(dst, src reflect.Value) {
+	switch src.Kind() {
+	case reflect.Ptr:
+		if src.IsNil() {
+			return
+		}
+		dst.Set(reflect.New(src.Type().Elem()))
+		copyValue(dst.Elem(), src.Elem())
+	case reflect.Struct:
+		dst.Set(src)
+		for i := 0; i < src.NumField(); i++ {
+			if src.Type().Field(i).PkgPath == "" {
+				copyValue(dst.Field(i), src.Field(i))
+			}
+		}
+	case reflect.Slice:
+		if src.IsNil() {
+			return
+		}
+		dst.Set(reflect.MakeSlice(src.Type(), src.Len(), src.Len()))
+		for i := 0; i < src.Len(); i++ {
+			copyValue(dst.Index(i), src.Index(i))
+		}
+	case reflect.Map:
+		if src.IsNil() {
+			return
+		}
+		dst.Set(reflect.MakeMapWithSize(src.Type(), src.Len()))
+		iter := src.MapRange()
+		for iter.Next() {
+			val := reflect.New(src.Type().Elem()).Elem()
+			copyValue(val, iter.Value())
+			dst.SetMapIndex(iter.Key(), val)
+		}
+	default:
+		dst.Set(src)
+	}
+}
@@ -0,0 +1,218 @@
+package config
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+)
+
+type change struct {
+	old, updated *TestConf
+	changed      []string
+}
+
+func TestWatch(t *testing.T) {
+	file, err := ioutil.TempFile("", "conf.")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	require.NoError(t, ioutil.WriteFile(file.Name(), []byte("[section1]\nvarint1 = 11\nvarstring1 = \"first string\""), 0o600))
+
+	var c TestConf
+	i := New(&c)
+	conf := Config{ConfigFile: file.Name(), EnvPrefix: "HUP", WatchInterval: 10 * time.Millisecond}
+	require.NoError(t, i.Combine(conf))
+	changes := make(chan change, 1)
+	i.OnChange(func(old, updated interface{}, changed []string) {
+		changes <- change{old: old.(*TestConf), updated: updated.(*TestConf), changed: changed}
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errs := i.Watch(ctx, conf)
+
+	// Если файл изменился, конфиг перечитывается, а колбэк получает старое, новое значения и измененные поля.
+	t.Run("Reload on file change", func(t *testing.T) {
+		replaceFile(t, file.Name(), "[section1]\nvarint1 = 22\nvarstring1 = \"first string\"", time.Minute)
+		select {
+		case ch := <-changes:
+			require.Equal(t, 11, ch.old.Section1.VarInt1)
+			require.Equal(t, 22, ch.updated.Section1.VarInt1)
+			require.Equal(t, []string{"Section1.VarInt1"}, ch.changed)
+		case err := <-errs:
+			t.Fatal(err)
+		case <-time.After(time.Second):
+			t.Fatal("config was not reloaded")
+		}
+	})
+
+	// Если файл стал некорректным, конфиг не меняется, а ошибка попадает в канал.
+	t.Run("Failed reload keeps config", func(t *testing.T) {
+		replaceFile(t, file.Name(), "[section1]\nvarint1 = \"first string\"", 2*time.Minute)
+		select {
+		case err := <-errs:
+			require.Error(t, err)
+		case <-time.After(time.Second):
+			t.Fatal("reload error was not reported")
+		}
+		require.Equal(t, 22, i.Holder().Load().(*TestConf).Section1.VarInt1)
+	})
+
+	// По сигналу SIGHUP конфиг перечитывается без изменения файла.
+	t.Run("Reload on SIGHUP", func(t *testing.T) {
+		replaceFile(t, file.Name(), "[section1]\nvarint1 = 22", 3*time.Minute)
+		var ch change
+		select {
+		case ch = <-changes:
+		case <-time.After(time.Second):
+			t.Fatal("config was not reloaded")
+		}
+		require.Equal(t, []string{"Section1.VarString1"}, ch.changed)
+		require.NoError(t, os.Setenv("HUP_SECTION1_VARBOOL1", "true"))
+		defer os.Unsetenv("HUP_SECTION1_VARBOOL1")
+		require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGHUP))
+		select {
+		case ch := <-changes:
+			require.Equal(t, []string{"Section1.VarBool1"}, ch.changed)
+		case <-time.After(time.Second):
+			t.Fatal("config was not reloaded")
+		}
+	})
+}
+
+func TestWatchDB(t *testing.T) {
+
+	// Если таблица изменилась, конфиг перечитывается через тот же пул соединений.
+	t.Run("Reload on table change", func(t *testing.T) {
+		db, mock := newMock()
+		defer db.Close()
+		table := func(val string) *sqlmock.Rows {
+			return sqlmock.NewRows([]string{"key", "value"}).AddRow("section1.varint1", val)
+		}
+		mock.ExpectQuery("SELECT config.key, config.value FROM config").WillReturnRows(table("11"))
+		mock.ExpectQuery("SELECT config.key, config.value FROM config").WillReturnRows(table("11"))
+		mock.ExpectQuery("SELECT config.key, config.value FROM config").WillReturnRows(table("22"))
+		mock.ExpectQuery("SELECT config.key, config.value FROM config").WillReturnRows(table("22"))
+
+		var c TestConf
+		i := New(&c)
+		c.Section1.VarInt1 = 11
+		changes := make(chan []string, 1)
+		i.OnChange(func(old, updated interface{}, changed []string) {
+			changes <- changed
+		})
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		i.WatchDB(ctx, Config{DB: db, WatchInterval: 10 * time.Millisecond})
+		select {
+		case changed := <-changes:
+			require.Equal(t, []string{"Section1.VarInt1"}, changed)
+		case <-time.After(time.Second):
+			t.Fatal("config was not reloaded")
+		}
+		require.Equal(t, 22, i.Holder().Load().(*TestConf).Section1.VarInt1)
+	})
+
+	// Если задан запрос версии, таблица перечитывается только при изменении версии.
+	t.Run("Reload on version change", func(t *testing.T) {
+		db, mock := newMock()
+		defer db.Close()
+		version := func(val string) *sqlmock.Rows {
+			return sqlmock.NewRows([]string{"max"}).AddRow(val)
+		}
+		mock.ExpectQuery("SELECT max").WillReturnRows(version("1"))
+		mock.ExpectQuery("SELECT max").WillReturnRows(version("1"))
+		mock.ExpectQuery("SELECT max").WillReturnRows(version("2"))
+		mock.ExpectQuery("SELECT config.key, config.value FROM config").WillReturnRows(
+			sqlmock.NewRows([]string{"key", "value"}).AddRow("section1.varstring1", "first string"))
+
+		var c TestConf
+		i := New(&c)
+		changes := make(chan []string, 1)
+		i.OnChange(func(old, updated interface{}, changed []string) {
+			changes <- changed
+		})
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		i.WatchDB(ctx, Config{DB: db, WatchInterval: 10 * time.Millisecond, DBVersionQuery: "SELECT max(updated_at) FROM config"})
+		select {
+		case changed := <-changes:
+			require.Equal(t, []string{"Section1.VarString1"}, changed)
+		case <-time.After(time.Second):
+			t.Fatal("config was not reloaded")
+		}
+	})
+
+	// SetFromDB не закрывает переданный пул соединений.
+	t.Run("Pool is not closed", func(t *testing.T) {
+		db, mock := newMock()
+		defer db.Close()
+		mock.ExpectQuery("SELECT config.key, config.value FROM config").WillReturnRows(sqlmock.NewRows([]string{"key", "value"}))
+		mock.ExpectQuery("SELECT config.key, config.value FROM config").WillReturnRows(sqlmock.NewRows([]string{"key", "value"}))
+		var c TestConf
+		require.NoError(t, New(&c).SetFromDB(db, "config"))
+		require.NoError(t, New(&c).SetFromDB(db, "config"))
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+// replaceFile atomically replaces the file content and sets its modification time.
+func replaceFile(t *testing.T, name, content string, shift time.Duration) {
+	tmp := name + ".tmp"
+	require.NoError(t, ioutil.WriteFile(tmp, []byte(content), 0o600))
+	require.NoError(t, os.Chtimes(tmp, time.Now(), time.Now().Add(shift)))
+	require.NoError(t, os.Rename(tmp, name))
+}
+
+type ReloadConf struct {
+	Section1 struct {
+		VarInt1    int
+		VarString1 string
+	}
+	Hosts []string
+}
+
+func TestReload(t *testing.T) {
+
+	// Значения, заданные в структуре до Combine, сохраняются при перечитывании.
+	t.Run("Prefilled values survive reload", func(t *testing.T) {
+		require.NoError(t, os.Setenv("RLD_SECTION1_VARINT1", "11"))
+		defer os.Unsetenv("RLD_SECTION1_VARINT1")
+		var c ReloadConf
+		c.Section1.VarString1 = "prefilled"
+		c.Hosts = []string{"a"}
+		i := New(&c)
+		conf := Config{EnvPrefix: "RLD"}
+		require.NoError(t, i.Combine(conf))
+		require.NoError(t, os.Setenv("RLD_SECTION1_VARINT1", "22"))
+		require.NoError(t, i.Reload(conf))
+		require.Equal(t, 22, c.Section1.VarInt1)
+		require.Equal(t, "prefilled", c.Section1.VarString1)
+		require.Equal(t, []string{"a"}, c.Hosts)
+	})
+
+	// Колбэк получает копии, изменение которых не затрагивает конфиг.
+	t.Run("Callbacks get deep copies", func(t *testing.T) {
+		require.NoError(t, os.Setenv("RLC_HOSTS", "a,b"))
+		defer os.Unsetenv("RLC_HOSTS")
+		var c ReloadConf
+		i := New(&c)
+		conf := Config{EnvPrefix: "RLC"}
+		require.NoError(t, i.Combine(conf))
+		i.OnChange(func(old, updated interface{}, changed []string) {
+			old.(*ReloadConf).Hosts[0] = "changed"
+			updated.(*ReloadConf).Hosts[0] = "changed"
+		})
+		require.NoError(t, os.Setenv("RLC_HOSTS", "c,d"))
+		require.NoError(t, i.Reload(conf))
+		require.Equal(t, []string{"c", "d"}, c.Hosts)
+		require.Equal(t, []string{"c", "d"}, i.Holder().Load().(*ReloadConf).Hosts)
+	})
+}